@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const adminPrefix = "/admin/v1/"
+
+// authorizeAdmin checks that the request carries an API key whose label is
+// listed in admin.labels. The admin API doesn't exist when no label is listed.
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) (label string, ok bool) {
+	labels := Config().Admin.Labels
+	if len(labels) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	label, err := authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	for _, allowed := range labels {
+		if label == allowed && label != "" {
+			return label, true
+		}
+	}
+	log.WithField("key", label).WithField("remote", r.RemoteAddr).Warn("admin: forbidden")
+	writeError(w, http.StatusForbidden, "API key not allowed to use the admin API")
+	return
+}
+
+// handleAdmin serves the admin API:
+//
+//	GET    /admin/v1/clients          connected clients
+//	GET    /admin/v1/clients/{guid}   one client
+//	DELETE /admin/v1/clients/{guid}   disconnect a client
+//	GET    /admin/v1/runner           ASR runner state
+//	POST   /admin/v1/runner/restart   restart the ASR process
+//	POST   /admin/v1/runner/warmup    run the warmup again
+//	POST   /admin/v1/config/reload    reload the config file, like SIGHUP
+func handleAdmin(w http.ResponseWriter, r *http.Request) {
+	label, ok := authorizeAdmin(w, r)
+	if !ok {
+		return
+	}
+	alog := log.WithField("key", label).WithField("remote", r.RemoteAddr)
+	route := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, adminPrefix), "/"), "/")
+
+	switch {
+	case len(route) == 1 && route[0] == "clients":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		writeJSON(w, http.StatusOK, listClients())
+
+	case len(route) == 2 && route[0] == "clients":
+		client, found := findSession(route[1])
+		if !found {
+			writeError(w, http.StatusNotFound, "no such client")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, client.Info())
+		case http.MethodDelete:
+			alog.WithField("guid", client.GUID).Println("admin: disconnecting client")
+			client.End(EndKicked, "disconnected by an administrator")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+
+	case len(route) == 1 && route[0] == "runner":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		writeJSON(w, http.StatusOK, asr.State())
+
+	case len(route) == 2 && route[0] == "runner" && route[1] == "restart":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		alog.Println("admin: restarting ASR process")
+		asr.Restart()
+		w.WriteHeader(http.StatusAccepted)
+
+	case len(route) == 2 && route[0] == "runner" && route[1] == "warmup":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		alog.Println("admin: running warmup")
+		if err := rewarmup(); err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+
+	case len(route) == 2 && route[0] == "config" && route[1] == "reload":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		alog.Println("admin: reloading config")
+		if err := ReloadConfig(); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusNotFound, "unknown admin endpoint")
+	}
+}
+
+// listClients returns the connected clients, oldest first.
+func listClients() []ClientInfo {
+	sessionsEx.Lock()
+	infos := make([]ClientInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, session.Info())
+	}
+	sessionsEx.Unlock()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Connected.Before(infos[j].Connected)
+	})
+	return infos
+}
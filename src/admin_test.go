@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cowdude/flapi/src/audio"
+)
+
+// adminRequest sends a request to the admin API with an API key.
+func adminRequest(t *testing.T, method, path, key string) *http.Response {
+	r := httptest.NewRequest(method, path, nil)
+	if key != "" {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	handleAdmin(w, r)
+	return w.Result()
+}
+
+func TestAdminDisabled(t *testing.T) {
+	withAuth(t, func(cfg *Configuration) {
+		addKey(cfg, "admin-key", "admin", nil)
+		cfg.Admin.Labels = nil
+	})
+	if res := adminRequest(t, http.MethodGet, "/admin/v1/clients", "admin-key"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("admin API without labels: got %v, want 404", res.Status)
+	}
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	withAuth(t, func(cfg *Configuration) {
+		addKey(cfg, "admin-key", "admin", nil)
+		addKey(cfg, "user-key", "user", nil)
+		cfg.Admin.Labels = []string{"admin"}
+	})
+	for key, want := range map[string]int{
+		"":          http.StatusUnauthorized,
+		"wrong-key": http.StatusUnauthorized,
+		"user-key":  http.StatusForbidden,
+		"admin-key": http.StatusOK,
+	} {
+		res := adminRequest(t, http.MethodGet, "/admin/v1/clients", key)
+		if res.StatusCode != want {
+			t.Errorf("key %q: got %v, want %d", key, res.Status, want)
+		}
+		if want == http.StatusUnauthorized && res.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("key %q: no WWW-Authenticate header", key)
+		}
+	}
+
+	//without configured keys, every client has the empty label, which is never an admin
+	withAuth(t, func(cfg *Configuration) { cfg.Admin.Labels = []string{""} })
+	if res := adminRequest(t, http.MethodGet, "/admin/v1/clients", ""); res.StatusCode != http.StatusForbidden {
+		t.Errorf("anonymous admin: got %v, want 403", res.Status)
+	}
+}
+
+func TestAdminKickClient(t *testing.T) {
+	withAuth(t, func(cfg *Configuration) {
+		addKey(cfg, "admin-key", "admin", nil)
+		cfg.Admin.Labels = []string{"admin"}
+	})
+	s := NewSession(context.Background(), SessionOptions{Transport: "test", Overflow: audio.Block})
+	registerSession(s)
+	defer unregisterSession(s)
+	defer s.Close()
+
+	res := adminRequest(t, http.MethodGet, "/admin/v1/clients", "admin-key")
+	var clients []ClientInfo
+	if err := json.NewDecoder(res.Body).Decode(&clients); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, c := range clients {
+		found = found || c.GUID == s.GUID
+	}
+	if !found {
+		t.Fatalf("session %v not listed in %+v", s.GUID, clients)
+	}
+
+	if res = adminRequest(t, http.MethodDelete, "/admin/v1/clients/"+s.GUID, "admin-key"); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("kick: got %v, want 204", res.Status)
+	}
+	<-s.Done()
+	if reason, _ := s.EndReason(); reason != EndKicked {
+		t.Errorf("kicked session ended with %v", reason)
+	}
+	if res = adminRequest(t, http.MethodDelete, "/admin/v1/clients/unknown", "admin-key"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("kick of an unknown client: got %v, want 404", res.Status)
+	}
+	if res = adminRequest(t, http.MethodDelete, "/admin/v1/clients/"+s.GUID, "user-key"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("kick with an unknown key: got %v, want 401", res.Status)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// apiError is the body of the error responses of the HTTP APIs.
+type apiError struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, apiError{Error: message})
+}
+
+// writeCodedError writes an error with a machine-readable code, such as the codes of QuotaError.
+func writeCodedError(w http.ResponseWriter, code int, errCode, message string) {
+	writeJSON(w, code, apiError{Error: message, Code: errCode})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// errBodyTooLarge is returned by the bodies of limitBody past their limit.
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitedBody reads at most n bytes of a request body, then fails with errBodyTooLarge.
+type limitedBody struct {
+	io.Reader
+	n int64 //bytes left
+}
+
+// limitBody limits the size of a request body. Unlike http.MaxBytesReader, the
+// error can be told apart from the others with errors.Is.
+func limitBody(body io.Reader, n int64) io.Reader {
+	return &limitedBody{body, n}
+}
+
+func (body *limitedBody) Read(p []byte) (n int, err error) {
+	if body.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > body.n+1 {
+		p = p[:body.n+1] //one more byte tells whether the body goes past the limit
+	}
+	n, err = body.Reader.Read(p)
+	if int64(n) > body.n {
+		n, body.n = int(body.n), -1
+		return n, errBodyTooLarge
+	}
+	body.n -= int64(n)
+	return
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestLimitBody(t *testing.T) {
+	for _, tt := range []struct {
+		size, limit int64
+		err         error
+	}{
+		{size: 0, limit: 10},
+		{size: 10, limit: 10},
+		{size: 11, limit: 10, err: errBodyTooLarge},
+		{size: 100 << 10, limit: 64 << 10, err: errBodyTooLarge},
+	} {
+		data, err := io.ReadAll(limitBody(bytes.NewReader(make([]byte, tt.size)), tt.limit))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%d bytes, limit %d: error %v, want %v", tt.size, tt.limit, err, tt.err)
+		}
+		if max := tt.limit; int64(len(data)) > max {
+			t.Errorf("%d bytes, limit %d: read %d bytes", tt.size, tt.limit, len(data))
+		}
+	}
+}
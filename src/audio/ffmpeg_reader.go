@@ -2,8 +2,10 @@ package audio
 
 import (
 	"context"
+	"io"
 	"os"
 	"os/exec"
+	"sync/atomic"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -18,20 +20,35 @@ const (
 
 type FFReader struct {
 	AudioReader
+	stdout  io.Closer
 	lastErr error
 	waitErr chan error
 }
 
+var runningProcesses int64
+
+// RunningProcesses returns the number of ffmpeg processes that were started
+// and not yet reaped.
+func RunningProcesses() int {
+	return int(atomic.LoadInt64(&runningProcesses))
+}
+
 func ffmpegReader(ctx context.Context, stdin AudioReader, args ...string) (res FFReader) {
 	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
 	cmd.Stdin = stdin
 
+	//unlike cmd.StdoutPipe, the read end is not closed by cmd.Wait: the output
+	//of a process that exited early is still read until EOF
+	var stdoutW *os.File
 	for _, arg := range args {
 		if arg == "-" {
-			res.AudioReader, res.lastErr = cmd.StdoutPipe()
+			var stdout *os.File
+			stdout, stdoutW, res.lastErr = os.Pipe()
 			if res.lastErr != nil {
 				return
 			}
+			cmd.Stdout = stdoutW
+			res.AudioReader, res.stdout = stdout, stdout
 			break
 		}
 	}
@@ -42,14 +59,23 @@ func ffmpegReader(ctx context.Context, stdin AudioReader, args ...string) (res F
 
 	log.Debugf("starting ffmpeg: %v", args)
 	res.lastErr = cmd.Start()
+	if stdoutW != nil {
+		stdoutW.Close() //owned by the process now
+	}
 	if res.lastErr != nil {
+		if res.stdout != nil {
+			res.stdout.Close()
+		}
 		return
 	}
+	atomic.AddInt64(&runningProcesses, 1)
 
 	//watchdog
-	res.waitErr = make(chan error)
+	res.waitErr = make(chan error, 1)
 	go func() {
-		res.waitErr <- cmd.Wait()
+		err := cmd.Wait()
+		atomic.AddInt64(&runningProcesses, -1)
+		res.waitErr <- err
 		close(res.waitErr)
 	}()
 	return
@@ -61,3 +87,12 @@ func (reader *FFReader) Wait() error {
 	}
 	return reader.lastErr
 }
+
+// Close stops reading the process output, and waits for it to exit.
+// The process stdin must be closed (or the context canceled) beforehand.
+func (reader *FFReader) Close() error {
+	if reader.stdout != nil {
+		reader.stdout.Close()
+	}
+	return reader.Wait()
+}
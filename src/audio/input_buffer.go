@@ -0,0 +1,151 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// OverflowPolicy tells an InputBuffer what to do with writes that would exceed its capacity.
+type OverflowPolicy string
+
+const (
+	// Block waits for the reader to make room in the buffer.
+	Block OverflowPolicy = "block"
+	// DropOldest discards the oldest buffered chunks to make room for the new one.
+	DropOldest OverflowPolicy = "drop_oldest"
+	// Reject discards the new chunk.
+	Reject OverflowPolicy = "reject"
+)
+
+var ErrOverflow = errors.New("audio input buffer overflow")
+
+func (policy *OverflowPolicy) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	var text string
+	if err = unmarshal(&text); err != nil {
+		return
+	}
+	switch p := OverflowPolicy(text); p {
+	case Block, DropOldest, Reject:
+		*policy = p
+		return
+	}
+	return fmt.Errorf("unknown overflow policy '%v'", text)
+}
+
+// InputBuffer is a bounded FIFO of audio chunks, written by the network
+// side of a session and read by the transcoder.
+type InputBuffer struct {
+	// OnOverflow, when set, is called with the number of bytes lost
+	// whenever a write overflows the buffer.
+	OnOverflow func(lost int)
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	chunks   [][]byte
+	size     int
+	capacity int
+	policy   OverflowPolicy
+	closed   bool
+}
+
+// NewInputBuffer returns a buffer holding up to capacity bytes. A single chunk
+// larger than capacity is still accepted when the buffer is empty.
+func NewInputBuffer(capacity int, policy OverflowPolicy) *InputBuffer {
+	buf := &InputBuffer{
+		capacity: capacity,
+		policy:   policy,
+	}
+	buf.cond = sync.NewCond(&buf.mu)
+	return buf
+}
+
+func (buf *InputBuffer) Read(dst []byte) (n int, err error) {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+	for len(buf.chunks) == 0 && !buf.closed {
+		buf.cond.Wait()
+	}
+	if len(buf.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n = copy(dst, buf.chunks[0])
+	if buf.chunks[0] = buf.chunks[0][n:]; len(buf.chunks[0]) == 0 {
+		buf.chunks[0] = nil
+		buf.chunks = buf.chunks[1:]
+	}
+	buf.size -= n
+	buf.cond.Broadcast()
+	return
+}
+
+// Write queues src, which is retained by the buffer until it is read.
+func (buf *InputBuffer) Write(src []byte) (n int, err error) {
+	if len(src) == 0 {
+		return
+	}
+	var lost int
+	buf.mu.Lock()
+	if buf.closed {
+		buf.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	overflows := func() bool {
+		return buf.size != 0 && buf.size+len(src) > buf.capacity
+	}
+	switch buf.policy {
+	case Reject:
+		if overflows() {
+			lost, err = len(src), ErrOverflow
+		}
+	case DropOldest:
+		for overflows() {
+			lost += len(buf.chunks[0])
+			buf.size -= len(buf.chunks[0])
+			buf.chunks[0] = nil
+			buf.chunks = buf.chunks[1:]
+		}
+	default:
+		for overflows() && !buf.closed {
+			buf.cond.Wait()
+		}
+		if buf.closed {
+			err = io.ErrClosedPipe
+		}
+	}
+	if err == nil {
+		buf.chunks = append(buf.chunks, src)
+		buf.size += len(src)
+		n = len(src)
+		buf.cond.Broadcast()
+	}
+	buf.mu.Unlock()
+
+	if lost != 0 && buf.OnOverflow != nil {
+		buf.OnOverflow(lost)
+	}
+	return
+}
+
+// Buffered returns the number of bytes waiting to be read.
+func (buf *InputBuffer) Buffered() int {
+	buf.mu.Lock()
+	defer buf.mu.Unlock()
+	return buf.size
+}
+
+// Cap returns the buffer capacity, in bytes.
+func (buf *InputBuffer) Cap() int {
+	return buf.capacity
+}
+
+// Close rejects further writes. Pending data can still be read, after which
+// readers get io.EOF. It is safe to call Close multiple times.
+func (buf *InputBuffer) Close() error {
+	buf.mu.Lock()
+	buf.closed = true
+	buf.cond.Broadcast()
+	buf.mu.Unlock()
+	return nil
+}
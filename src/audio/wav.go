@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -41,6 +40,21 @@ type WAVEInfo struct {
 	dataSize        uint32
 }
 
+// Duration returns the playback duration of n bytes of audio data.
+func (info WAVEInfo) Duration(n int) time.Duration {
+	if info.nAvgBytesPerSec == 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second / time.Duration(info.nAvgBytesPerSec)
+}
+
+// WithDataSize returns the header of a WAV file holding n bytes of audio data.
+func (info WAVEInfo) WithDataSize(n int) WAVEInfo {
+	info.FileSize = uint32(WAVHeaderSize - 8 + n) //RIFF chunk size
+	info.dataSize = uint32(n)
+	return info
+}
+
 type waveReader struct {
 	scratch [8]byte
 	WAVEInfo
@@ -68,6 +82,10 @@ func (gain *Gain) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
 	return fmt.Errorf("unable to parse %v as gain", text)
 }
 
+func (gain Gain) MarshalYAML() (interface{}, error) {
+	return fmt.Sprintf("%gdB", gain.Decibels()), nil
+}
+
 func (id str4) String() string       { return string(id[:]) }
 func (buf PCMBuffer) String() string { return fmt.Sprintf("[PCM len=%v cap=%v]", len(buf), cap(buf)) }
 
@@ -184,12 +202,8 @@ func (wav *waveReader) sample16() (samples PCMBuffer) {
 		wav.err = io.ErrShortBuffer
 		return nil
 	}
-	sh := reflect.SliceHeader{
-		Data: uintptr(unsafe.Pointer(&wav.scratch[0])),
-		Len:  read / sampleSize,
-		Cap:  read / sampleSize,
-	}
-	return *(*PCMBuffer)(unsafe.Pointer(&sh))
+	n := read / sampleSize
+	return (*[len(wav.scratch) / sampleSize]int16)(unsafe.Pointer(&wav.scratch[0]))[:n:n]
 }
 
 type Activity struct {
@@ -207,6 +221,17 @@ type ActivityOpts struct {
 	ContextPrefix   time.Duration `yaml:"context_prefix"`
 }
 
+// DefaultActivityOpts returns the activity settings used when not configured.
+func DefaultActivityOpts() ActivityOpts {
+	return ActivityOpts{
+		Threshold:       Decibels(-23),
+		GainSmooth:      0.97,
+		ActivityTimeout: 300 * time.Millisecond,
+		BufferDuration:  10 * time.Second,
+		ContextPrefix:   150 * time.Millisecond,
+	}
+}
+
 func ScanActivity(ctx context.Context, src AudioReader, nfo chan<- WAVEInfo, c chan<- Activity, opts ActivityOpts) (err error) {
 	wav := waveReader{src: src}
 	if ok := wav.header(); !ok {
@@ -217,7 +242,11 @@ func ScanActivity(ctx context.Context, src AudioReader, nfo chan<- WAVEInfo, c c
 	if err != nil {
 		return
 	}
-	nfo <- wav.WAVEInfo
+	select {
+	case nfo <- wav.WAVEInfo:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 	if wav.nc != 1 {
 		log.Panicf("monochannel WAV only, but found %v channels", wav.nc)
 	}
@@ -263,9 +292,42 @@ func ScanActivity(ctx context.Context, src AudioReader, nfo chan<- WAVEInfo, c c
 	log.Printf("nBlockAlign: %v", wav.nBlockAlign)
 	log.Printf("context frames: %v", contextFrames)
 
+	// emit sends the active window ending at the current sample.
+	emit := func() error {
+		data := buffers[back].Bytes()
+		lastn := int((atSample - beginActiveFrame + contextFrames) * 2) //PCM 16bits
+		if lastn < 0 {
+			lastn = 0
+		}
+		if lastn > len(data) {
+			lastn = len(data)
+		}
+		frames := data[len(data)-lastn:]
+		meanActiveGain /= Gain(meanActiveGainCount)
+		select {
+		case c <- Activity{
+			Start:    time.Duration(beginActiveFrame) * time.Second / time.Duration(wav.sr),
+			Duration: time.Duration(atSample-beginActiveFrame) * time.Second / time.Duration(wav.sr),
+			Mean:     meanActiveGain,
+			Frames:   frames,
+		}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		back = (back + 1) % len(buffers)
+		buffers[back].Reset()
+		beginActiveFrame = -1
+		meanActiveGain = 0
+		meanActiveGainCount = 0
+		return nil
+	}
+
 	nospam := time.NewTicker(time.Second * 5)
 	defer nospam.Stop()
 	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
 		samples := wav.sample16()
 		err = wav.err
 		if err == io.EOF {
@@ -273,6 +335,11 @@ func ScanActivity(ctx context.Context, src AudioReader, nfo chan<- WAVEInfo, c c
 				panic("samples !=0 at EOF")
 			}
 			err = nil
+			if beginActiveFrame != -1 && atSample-beginActiveFrame > activationWindow {
+				//the input ended while speaking: flush the validated active window
+				log.Debugf("active window closed by EOF at %v", atSample)
+				err = emit()
+			}
 			return
 		} else if err != nil {
 			return
@@ -339,27 +406,9 @@ func ScanActivity(ctx context.Context, src AudioReader, nfo chan<- WAVEInfo, c c
 					//found closure
 					log.Debugf("active window closed at %v: dlow=%v dhigh=%v",
 						atSample, nLow-endLow, nHigh-endHigh)
-					data := buffers[back].Bytes()
-					lastn := int((atSample - beginActiveFrame + contextFrames) * 2) //PCM 16bits
-					if lastn < 0 {
-						lastn = 0
-					}
-					if lastn > len(data) {
-						lastn = len(data)
-					}
-					frames := data[len(data)-lastn:]
-					meanActiveGain /= Gain(meanActiveGainCount)
-					c <- Activity{
-						Start:    time.Duration(beginActiveFrame) * time.Second / time.Duration(wav.sr),
-						Duration: time.Duration(atSample-beginActiveFrame) * time.Second / time.Duration(wav.sr),
-						Mean:     meanActiveGain,
-						Frames:   frames,
+					if err = emit(); err != nil {
+						return
 					}
-					back = (back + 1) % len(buffers)
-					buffers[back].Reset()
-					beginActiveFrame = -1
-					meanActiveGain = 0
-					meanActiveGainCount = 0
 				} else {
 					log.Tracef("rejected closure at %v: dlow=%v dhigh=%v", atSample, nLow-endLow, nHigh-endHigh)
 					closeNotBefore = atSample + deactivationWindow
@@ -372,10 +421,7 @@ func ScanActivity(ctx context.Context, src AudioReader, nfo chan<- WAVEInfo, c c
 				//drop oldest record to make some room
 				buffers[back].Advance(nbytes - wcap)
 			}
-			buffers[back].Write(*(*[]byte)(unsafe.Pointer(&reflect.SliceHeader{
-				Data: uintptr(unsafe.Pointer(&s)),
-				Cap:  nbytes, Len: nbytes,
-			})))
+			buffers[back].Write((*[nbytes]byte)(unsafe.Pointer(&s))[:])
 
 			meanActiveGain += Gain(math.Abs(dg))
 			meanActiveGainCount++
@@ -384,6 +430,28 @@ func ScanActivity(ctx context.Context, src AudioReader, nfo chan<- WAVEInfo, c c
 	}
 }
 
+// ReadWAV reads a 16 bits mono PCM WAV stream: its format, and its audio data.
+func ReadWAV(src io.Reader) (info WAVEInfo, data []byte, err error) {
+	wav := waveReader{src: src}
+	if ok := wav.header(); !ok {
+		if err = wav.err; err == nil {
+			err = errors.New("invalid WAV header")
+		}
+		return
+	}
+	if wav.nc != 1 || wav.bps != 16 || wav.fmt != 1 {
+		err = fmt.Errorf("16 bits mono PCM WAV only, got format 0x%X, %d channels, %d bits", wav.fmt, wav.nc, wav.bps)
+		return
+	}
+	if data, err = io.ReadAll(src); err != nil {
+		return
+	}
+	if size := int(wav.dataSize); wav.dataSize != 0xFFFFFFFF && size > 0 && size < len(data) {
+		data = data[:size]
+	}
+	return wav.WAVEInfo, data, nil
+}
+
 type waveWriter struct {
 	WAVEInfo
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var errUnauthorized = errors.New("missing or invalid API key")
+
+func limitsFor(label string) Limits {
+	cfg := Config()
+	if label == watchKeyLabel {
+		return cfg.Watch.Limits
+	}
+	if limits, ok := cfg.keyLimits[label]; ok {
+		return limits
+	}
+	return cfg.Auth.Limits
+}
+
+// loadKeyring builds the keyring from the static keys of the config file, and
+// from the hashed keys file. The keyring maps SHA-256 digests of the accepted
+// API keys to their labels; an empty keyring disables authentication.
+// Each line of the keys file holds a label and the hex-encoded SHA-256 digest
+// of a key, separated by whitespace. Static keys may also override limits.
+func loadKeyring(cfg *Configuration) (ring map[[sha256.Size]byte]string, keyLimits map[string]Limits, err error) {
+	ring = make(map[[sha256.Size]byte]string)
+	keyLimits = make(map[string]Limits)
+	for _, key := range cfg.Auth.Keys {
+		if key.Key == "" {
+			return nil, nil, fmt.Errorf("empty API key for label '%v'", key.Label)
+		}
+		if key.Label == watchKeyLabel {
+			return nil, nil, fmt.Errorf("label '%v' is reserved for the watch folders", key.Label)
+		}
+		ring[sha256.Sum256([]byte(key.Key))] = key.Label
+		if key.Limits != nil {
+			keyLimits[key.Label] = *key.Limits
+		}
+	}
+	if cfg.Auth.KeysFile == "" {
+		return
+	}
+
+	f, err := os.Open(cfg.Auth.KeysFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("%v:%d: expected '<label> <sha256>'", cfg.Auth.KeysFile, lineno)
+		}
+		var digest [sha256.Size]byte
+		if n, err := hex.Decode(digest[:], []byte(fields[1])); err != nil || n != len(digest) {
+			return nil, nil, fmt.Errorf("%v:%d: invalid SHA-256 digest", cfg.Auth.KeysFile, lineno)
+		}
+		if fields[0] == watchKeyLabel {
+			return nil, nil, fmt.Errorf("%v:%d: label '%v' is reserved for the watch folders", cfg.Auth.KeysFile, lineno, fields[0])
+		}
+		ring[digest] = fields[0]
+	}
+	return ring, keyLimits, scanner.Err()
+}
+
+// authenticate returns the label of the API key presented by the request.
+// Keys are read from the Authorization (bearer) or X-API-Key headers, or from
+// the token query parameter for browsers, which can't set websocket headers.
+func authenticate(r *http.Request) (label string, err error) {
+	token := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); token == "" && strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	return lookupKey(token)
+}
+
+// lookupKey returns the label of an API key. Any key is accepted when no key is configured.
+func lookupKey(token string) (label string, err error) {
+	keyring := Config().keyring
+	if len(keyring) == 0 {
+		return
+	}
+	if token == "" {
+		return "", errUnauthorized
+	}
+	label, ok := keyring[sha256.Sum256([]byte(token))]
+	if !ok {
+		return "", errUnauthorized
+	}
+	return
+}
+
+// checkOrigin accepts requests without an Origin header (non-browser clients),
+// and browser requests whose origin matches the allowlist. Allowlist entries
+// may contain wildcards, as in https://*.example.com. An empty allowlist
+// accepts any origin.
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	origins := Config().Auth.Origins
+	if origin == "" || len(origins) == 0 {
+		return true
+	}
+	for _, pattern := range origins {
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+	log.WithField("origin", origin).Warn("Rejected websocket origin")
+	return false
+}
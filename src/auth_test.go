@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// addKey adds a static API key to the config.
+func addKey(cfg *Configuration, key, label string, limits *Limits) {
+	cfg.Auth.Keys = append(cfg.Auth.Keys, struct {
+		Key    string
+		Label  string
+		Limits *Limits
+	}{key, label, limits})
+}
+
+// withAuth changes the auth settings until the end of the test, and loads the
+// resulting keyring.
+func withAuth(t *testing.T, change func(cfg *Configuration)) {
+	withConfig(t, func(cfg *Configuration) {
+		cfg.Auth.Keys = nil
+		change(cfg)
+		var err error
+		if cfg.keyring, cfg.keyLimits, err = loadKeyring(cfg); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	request := func(header, value, query string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/v2/ws"+query, nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		return r
+	}
+	tests := []struct {
+		name  string
+		r     *http.Request
+		label string
+		ok    bool
+	}{
+		{"missing", request("", "", ""), "", false},
+		{"wrong", request("X-API-Key", "wrong", ""), "", false},
+		{"wrong bearer", request("Authorization", "Bearer wrong", ""), "", false},
+		{"not a bearer", request("Authorization", "Basic secret", ""), "", false},
+		{"header", request("X-API-Key", "secret", ""), "demo", true},
+		{"bearer", request("Authorization", "Bearer secret", ""), "demo", true},
+		{"query token", request("", "", "?token=secret"), "demo", true},
+		{"wrong query token", request("", "", "?token=wrong"), "", false},
+	}
+
+	//any key is accepted when none is configured
+	for _, tt := range tests {
+		if label, err := authenticate(tt.r); err != nil || label != "" {
+			t.Errorf("%v, no keys: got %q, %v", tt.name, label, err)
+		}
+	}
+
+	withAuth(t, func(cfg *Configuration) { addKey(cfg, "secret", "demo", nil) })
+	for _, tt := range tests {
+		label, err := authenticate(tt.r)
+		if tt.ok && (err != nil || label != tt.label) {
+			t.Errorf("%v: got %q, %v, want %q", tt.name, label, err, tt.label)
+		} else if !tt.ok && err != errUnauthorized {
+			t.Errorf("%v: got %q, %v, want unauthorized", tt.name, label, err)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handleWSv2))
+	defer server.Close()
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized || res.Header.Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("websocket without a key: got %v, want 401", res.Status)
+	}
+}
+
+func TestKeysFile(t *testing.T) {
+	digest := func(key string) string {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+	path := filepath.Join(t.TempDir(), "keys.txt")
+	write := func(lines ...string) {
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := *Config()
+	cfg.Auth.Keys = nil
+	cfg.Auth.KeysFile = path
+
+	write("# label sha256", "", "alice "+digest("alice-key"), "  bob\t"+strings.ToUpper(digest("bob-key")))
+	ring, _, err := loadKeyring(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"alice-key": "alice", "bob-key": "bob"} {
+		if label := ring[sha256.Sum256([]byte(key))]; label != want {
+			t.Errorf("%v: label %q, want %q", key, label, want)
+		}
+	}
+	if len(ring) != 2 {
+		t.Errorf("%d keys loaded, want 2", len(ring))
+	}
+
+	for _, tt := range []struct{ line, err string }{
+		{"alice", "keys.txt:1: expected '<label> <sha256>'"},
+		{"alice " + digest("key") + " extra", "keys.txt:1: expected '<label> <sha256>'"},
+		{"alice 0123", "keys.txt:1: invalid SHA-256 digest"},
+		{"alice " + digest("key")[1:] + "x", "keys.txt:1: invalid SHA-256 digest"},
+		{"watch " + digest("key"), "keys.txt:1: label 'watch' is reserved"},
+	} {
+		write(tt.line)
+		if _, _, err = loadKeyring(&cfg); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: got %v, want %q", tt.line, err, tt.err)
+		}
+	}
+
+	cfg.Auth.KeysFile = filepath.Join(t.TempDir(), "missing.txt")
+	if _, _, err = loadKeyring(&cfg); err == nil {
+		t.Error("no error for a missing keys file")
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	check := func(origin string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/v2/ws", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return checkOrigin(r)
+	}
+	if !check("https://evil.example.org") {
+		t.Error("origin rejected with an empty allowlist")
+	}
+
+	withConfig(t, func(cfg *Configuration) {
+		cfg.Auth.Origins = []string{"http://localhost:*", "https://*.example.com"}
+	})
+	for origin, want := range map[string]bool{
+		"":                          true, //not a browser
+		"http://localhost:8080":     true,
+		"https://app.example.com":   true,
+		"https://example.com":       false,
+		"http://app.example.com":    false,
+		"https://app.example.com.x": false,
+		"https://a.b.example.com":   true,
+		"http://localhost":          false,
+		"https://evil.example.org":  false,
+	} {
+		if ok := check(origin); ok != want {
+			t.Errorf("origin %q: accepted %v, want %v", origin, ok, want)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handleWSv2))
+	defer server.Close()
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	for k, v := range map[string]string{
+		"Origin": "https://evil.example.org", "Connection": "Upgrade", "Upgrade": "websocket",
+		"Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ==",
+	} {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("websocket from a rejected origin: got %v, want 403", res.Status)
+	}
+}
@@ -0,0 +1,556 @@
+// Package client streams audio to a flapi server over the /v2/ws protocol,
+// and delivers its events as Go types.
+//
+//	c, err := client.Dial(ctx, "ws://localhost:8080", client.Options{APIKey: key, Realtime: true})
+//	if err != nil { ... }
+//	go func() {
+//		err := c.StreamFile(ctx, "speech.wav") //sends eos, and waits for the last prediction
+//		c.Close()
+//	}()
+//	for e := range c.Events() {
+//		switch e := e.(type) {
+//		case *client.Prediction:
+//			fmt.Println(e.Segment, e.Text)
+//		}
+//	}
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Options tune a Client. Zero values pick the defaults.
+type Options struct {
+	APIKey string      //sent in the X-API-Key header
+	Header http.Header //additional headers of the websocket handshake
+	Dialer *websocket.Dialer
+
+	Overflow string //overrides input.overflow of the server for the session: block, drop_oldest or reject
+	NoSpeech bool   //don't receive Speech events
+
+	// OnEvent, when set, receives the events instead of the Events channel. It is
+	// called from the reader goroutine: blocking it stops reading the connection.
+	OnEvent     func(Event)
+	EventBuffer int //capacity of the Events channel, 64 by default
+
+	Reconnect        int           //reconnect attempts of Stream after a connection failure, none by default
+	ReconnectBackoff time.Duration //wait before the first reconnect attempt, doubled after each attempt, 1s by default
+
+	ChunkSize      int  //max bytes per binary message sent by Stream, 16KiB by default
+	Realtime       bool //pace Stream at real-time speed instead of sending as fast as possible
+	BytesPerSecond int  //pace of Realtime streams, read from the header of WAV input when zero
+}
+
+// EndError reports a session that did not end normally.
+type EndError struct {
+	Reason  string
+	Message string
+}
+
+func (e *EndError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("session ended: %v", e.Reason)
+	}
+	return fmt.Sprintf("session ended: %v: %v", e.Reason, e.Message)
+}
+
+// ErrClosed is returned by the methods of a closed Client.
+var ErrClosed = errors.New("client closed")
+
+// Client is a /v2/ws session. Stream may move it to a new connection when
+// reconnects are enabled; event segment indices and times stay continuous.
+type Client struct {
+	url    string
+	opts   Options
+	events chan Event
+
+	mu          sync.Mutex
+	conn        *conn
+	nextSegment uint //first segment index of the next connection
+
+	closed    chan struct{} //closed by Close, under mu
+	closeOnce sync.Once
+	readers   sync.WaitGroup //reader goroutines, which deliver events
+}
+
+// conn is a single websocket connection and its session.
+type conn struct {
+	ws      *websocket.Conn
+	writeMu sync.Mutex
+
+	segmentOffset uint
+	timeOffset    float64
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	done      chan struct{} //closed when the reader exits; end or err are set beforehand
+	end       *End
+	err       error
+}
+
+// wsURL returns the /v2/ws URL of a server, given as a base or full URL.
+func wsURL(server string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return "", fmt.Errorf("unsupported URL scheme '%v'", u.Scheme)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v2/ws"
+	}
+	return u.String(), nil
+}
+
+// Dial connects to a flapi server, such as ws://localhost:8080, and starts a session.
+func Dial(ctx context.Context, server string, opts Options) (c *Client, err error) {
+	if opts.EventBuffer <= 0 {
+		opts.EventBuffer = 64
+	}
+	if opts.ReconnectBackoff <= 0 {
+		opts.ReconnectBackoff = time.Second
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 16 << 10
+	}
+	c = &Client{
+		opts:   opts,
+		closed: make(chan struct{}),
+	}
+	if c.url, err = wsURL(server); err != nil {
+		return nil, err
+	}
+	if opts.OnEvent == nil {
+		c.events = make(chan Event, opts.EventBuffer)
+	}
+	if _, err = c.connect(ctx, 0, nil); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// connect opens a connection, makes it the current one, and starts its
+// session. The first event, when set, is delivered before the events of the
+// connection.
+func (c *Client) connect(ctx context.Context, timeOffset float64, first Event) (cn *conn, err error) {
+	dialer := c.opts.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	header := http.Header{}
+	for k, v := range c.opts.Header {
+		header[k] = v
+	}
+	if c.opts.APIKey != "" {
+		header.Set("X-API-Key", c.opts.APIKey)
+	}
+	ws, res, err := dialer.DialContext(ctx, c.url, header)
+	if err != nil {
+		if res != nil {
+			err = fmt.Errorf("%w (%v)", err, res.Status)
+		}
+		return nil, err
+	}
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		ws.Close()
+		return nil, ErrClosed
+	default:
+	}
+	cn = &conn{
+		ws:            ws,
+		segmentOffset: c.nextSegment,
+		timeOffset:    timeOffset,
+		ready:         make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	c.conn = cn //closed by Close from now on
+	c.readers.Add(1)
+	c.mu.Unlock()
+	go c.read(cn, first)
+
+	if c.opts.Overflow != "" || c.opts.NoSpeech {
+		speech := !c.opts.NoSpeech
+		err = cn.send(map[string]interface{}{"type": "config", "overflow": c.opts.Overflow, "speech": speech})
+	}
+	if err == nil {
+		err = cn.send(map[string]interface{}{"type": "start"})
+	}
+	if err != nil {
+		ws.Close()
+		<-cn.done
+		return nil, err
+	}
+	return
+}
+
+// read is the reader goroutine of a connection.
+func (c *Client) read(cn *conn, first Event) {
+	defer c.readers.Done()
+	defer close(cn.done)
+	if first != nil {
+		c.deliver(first)
+	}
+	for {
+		mt, data, err := cn.ws.ReadMessage()
+		if err != nil {
+			if cn.end == nil {
+				cn.err = err
+			}
+			return
+		}
+		if mt != websocket.TextMessage {
+			continue
+		}
+		e, err := decodeEvent(data)
+		if err != nil {
+			continue //sent by a newer server
+		}
+		switch e := e.(type) {
+		case *Hello:
+			if e.Ready {
+				cn.readyOnce.Do(func() { close(cn.ready) })
+			}
+		case *Status:
+			if e.Ready {
+				cn.readyOnce.Do(func() { close(cn.ready) })
+			}
+		case *Speech:
+			e.Segment += cn.segmentOffset
+			e.Start += cn.timeOffset
+			e.End += cn.timeOffset
+			c.seen(e.Segment)
+		case *Prediction:
+			e.Segment += cn.segmentOffset
+			c.seen(e.Segment)
+		case *Revision:
+			for i := range e.Segments {
+				e.Segments[i] += cn.segmentOffset
+			}
+		case *End:
+			cn.end = e
+		}
+		c.deliver(e)
+	}
+}
+
+func (c *Client) seen(segment uint) {
+	c.mu.Lock()
+	if segment >= c.nextSegment {
+		c.nextSegment = segment + 1
+	}
+	c.mu.Unlock()
+}
+
+func (c *Client) deliver(e Event) {
+	if c.opts.OnEvent != nil {
+		c.opts.OnEvent(e)
+		return
+	}
+	select {
+	case c.events <- e:
+	case <-c.closed:
+	}
+}
+
+func (cn *conn) send(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	cn.writeMu.Lock()
+	defer cn.writeMu.Unlock()
+	return cn.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *Client) current() *conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// Events returns the events of the session, or nil when Options.OnEvent is set.
+// The channel is closed by Close.
+func (c *Client) Events() <-chan Event {
+	return c.events
+}
+
+// WaitReady waits until the ASR of the server is ready to transcribe audio.
+// Audio sent before is dropped by the server.
+func (c *Client) WaitReady(ctx context.Context) error {
+	cn := c.current()
+	select {
+	case <-cn.ready:
+		return nil
+	case <-cn.done:
+		return cn.result()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Write sends audio to the server, as a single binary message.
+func (c *Client) Write(p []byte) (int, error) {
+	cn := c.current()
+	cn.writeMu.Lock()
+	defer cn.writeMu.Unlock()
+	if err := cn.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// EOS tells the server that the stream is over: the session ends once the
+// audio already sent is transcribed.
+func (c *Client) EOS() error {
+	return c.current().send(map[string]interface{}{"type": "eos"})
+}
+
+// Stop ends the session now, dropping the audio not transcribed yet.
+func (c *Client) Stop() error {
+	return c.current().send(map[string]interface{}{"type": "stop"})
+}
+
+// Ping sends a ping message, answered with a Pong event carrying the same id.
+func (c *Client) Ping(id string) error {
+	return c.current().send(map[string]interface{}{"type": "ping", "id": id})
+}
+
+// result returns the outcome of a finished connection.
+func (cn *conn) result() error {
+	switch {
+	case cn.end == nil && cn.err != nil:
+		return cn.err
+	case cn.end == nil:
+		return errors.New("connection closed without an end event")
+	case cn.end.Reason != ReasonNormal:
+		return &EndError{Reason: cn.end.Reason, Message: cn.end.Message}
+	}
+	return nil
+}
+
+// Wait waits for the end of the session. It returns nil when the session ended
+// normally, such as after EOS, and an *EndError or connection error otherwise.
+// All the events of the session were delivered when Wait returns.
+func (c *Client) Wait(ctx context.Context) error {
+	cn := c.current()
+	select {
+	case <-cn.done:
+		return cn.result()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the connection, which ends the session if it is still running,
+// and closes the Events channel.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		close(c.closed)
+		cn := c.conn
+		c.mu.Unlock()
+		cn.writeMu.Lock()
+		cn.ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+			time.Now().Add(time.Second))
+		cn.writeMu.Unlock()
+		cn.ws.Close()
+		c.readers.Wait()
+		if c.events != nil {
+			close(c.events)
+		}
+	})
+	return nil
+}
+
+// retryable tells whether Stream may resume on a new connection after a failure.
+func (cn *conn) retryable() bool {
+	select {
+	case <-cn.done:
+		return cn.end == nil || cn.end.Reason == ReasonShutdown
+	default:
+		return true //write error: the reader will notice soon
+	}
+}
+
+// reconnect moves the session to a new connection, with backoff, and waits
+// until the ASR of the server is ready: a restarting server drops the audio
+// sent during its warmup.
+func (c *Client) reconnect(ctx context.Context, attempt int, cause error, timeOffset float64) error {
+	old := c.current()
+	old.ws.Close()
+	<-old.done
+
+	backoff := c.opts.ReconnectBackoff << uint(attempt-1)
+	select {
+	case <-time.After(backoff):
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return ErrClosed
+	}
+	cn, err := c.connect(ctx, timeOffset, &Reconnected{Header: Header{Type: TReconnected}, Attempt: attempt, Err: cause})
+	if err != nil {
+		return err
+	}
+	select {
+	case <-cn.ready:
+		return nil
+	case <-cn.done:
+		if err = cn.result(); err == nil {
+			err = errors.New("session ended before the ASR was ready")
+		}
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return ErrClosed
+	}
+}
+
+// StreamFile streams a file, see Stream.
+func (c *Client) StreamFile(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.Stream(ctx, f)
+}
+
+// Stream sends the audio of r, any format supported by the server's ffmpeg,
+// then sends EOS and waits for the end of the session, see Wait. With
+// Options.Reconnect, Stream resumes on a new connection after connection
+// failures and server shutdowns; WAV input gets its header sent again.
+func (c *Client) Stream(ctx context.Context, r io.Reader) (err error) {
+	br := bufio.NewReaderSize(r, 4096) //small: the first read of a live source must not wait for a lot of audio
+	header, byteRate := sniffWAV(br)
+	rate := byteRate
+	if c.opts.BytesPerSecond > 0 {
+		rate = c.opts.BytesPerSecond
+	}
+	if c.opts.Realtime && rate == 0 {
+		return errors.New("real-time pacing requires Options.BytesPerSecond for non-WAV input")
+	}
+	if c.opts.Realtime && rate < 10 {
+		return fmt.Errorf("real-time pacing at %d bytes per second: at least 10 are required", rate)
+	}
+	chunkSize := c.opts.ChunkSize
+	if c.opts.Realtime && chunkSize > rate/10 {
+		chunkSize = rate / 10 //100ms messages
+	}
+
+	var (
+		chunk   = make([]byte, chunkSize)
+		sent    int //bytes of r sent so far
+		started = time.Now()
+		attempt int
+	)
+	for {
+		n, rerr := br.Read(chunk)
+		if n > 0 {
+			if c.opts.Realtime {
+				due := started.Add(time.Duration(float64(sent) / float64(rate) * float64(time.Second)))
+				select {
+				case <-time.After(time.Until(due)):
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-c.closed:
+					return ErrClosed
+				}
+			}
+			for {
+				cn := c.current()
+				if isDone(cn) {
+					err = cn.result()
+				} else {
+					_, err = c.Write(chunk[:n])
+				}
+				if err == nil {
+					break
+				}
+				if attempt >= c.opts.Reconnect || !cn.retryable() {
+					return
+				}
+				attempt++
+				var timeOffset float64
+				if byteRate > 0 && sent > len(header) {
+					timeOffset = float64(sent-len(header)) / float64(byteRate)
+				}
+				if err = c.reconnect(ctx, attempt, err, timeOffset); err != nil {
+					if ctx.Err() != nil || err == ErrClosed {
+						return
+					}
+					continue //the server is not back yet
+				}
+				if header != nil && sent >= len(header) {
+					c.Write(header) //errors show up with the next chunk
+				}
+			}
+			sent += n
+		}
+		if rerr == io.EOF {
+			break
+		} else if rerr != nil {
+			return rerr
+		}
+	}
+	if err = c.EOS(); err != nil {
+		return
+	}
+	return c.Wait(ctx)
+}
+
+func isDone(cn *conn) bool {
+	select {
+	case <-cn.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sniffWAV returns the header of WAV input, up to its data, and its byte rate.
+// It returns nil and 0 for other formats.
+func sniffWAV(br *bufio.Reader) (header []byte, byteRate int) {
+	peek, _ := br.Peek(4096)
+	if len(peek) < 12 || string(peek[:4]) != "RIFF" || string(peek[8:12]) != "WAVE" {
+		return nil, 0
+	}
+	for off := 12; off+8 <= len(peek); {
+		id, size := string(peek[off:off+4]), int(binary.LittleEndian.Uint32(peek[off+4:off+8]))
+		switch id {
+		case "fmt ":
+			if off+20 <= len(peek) {
+				byteRate = int(binary.LittleEndian.Uint32(peek[off+16 : off+20]))
+			}
+		case "data":
+			return append([]byte(nil), peek[:off+8]...), byteRate
+		}
+		off += 8 + size + size%2
+	}
+	return nil, 0
+}
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeServer runs a /v2/ws stand-in: each connection follows the script of
+// its rank, starting at 1.
+func fakeServer(t *testing.T, script func(n int, ws *websocket.Conn)) string {
+	var conns int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		script(int(atomic.AddInt32(&conns, 1)), ws)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// expect reads the messages of the client until a text message of the given type.
+func expect(ws *websocket.Conn, typ string) error {
+	for {
+		var msg struct{ Type string }
+		mt, data, err := ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if mt == websocket.TextMessage && json.Unmarshal(data, &msg) == nil && msg.Type == typ {
+			return nil
+		}
+	}
+}
+
+// testWAV returns a WAV file of n bytes of silence, at 32000 bytes per second.
+func testWAV(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+n))
+	buf.WriteString("WAVEfmt ")
+	for _, field := range []interface{}{
+		uint32(16), uint16(1), uint16(1), uint32(16000), uint32(32000), uint16(2), uint16(16),
+	} {
+		binary.Write(&buf, binary.LittleEndian, field)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(n))
+	buf.Write(make([]byte, n))
+	return buf.Bytes()
+}
+
+// pausedReader reads the first n bytes of data, then waits for resume before
+// reading the rest: Stream only reconnects when it fails to send audio.
+func pausedReader(data []byte, n int, resume <-chan struct{}) io.Reader {
+	r, w := io.Pipe()
+	go func() {
+		w.Write(data[:n])
+		<-resume
+		time.Sleep(50 * time.Millisecond) //for the client to see the end of the connection
+		w.Write(data[n:])
+		w.Close()
+	}()
+	return r
+}
+
+func TestStreamReconnectWaitsForReady(t *testing.T) {
+	result := make(chan error, 1)
+	shutdown := make(chan struct{})
+	url := fakeServer(t, func(n int, ws *websocket.Conn) {
+		ws.WriteJSON(map[string]interface{}{"type": "hello", "ready": n == 1})
+		if expect(ws, "start") != nil {
+			return
+		}
+		ws.WriteJSON(map[string]interface{}{"type": "started"})
+		if n == 1 {
+			ws.ReadMessage()
+			ws.WriteJSON(map[string]interface{}{"type": "end", "reason": "shutdown"})
+			close(shutdown)
+			return
+		}
+
+		//the restarted server warms up: audio sent meanwhile would be dropped
+		var ready int32
+		statusSent := make(chan struct{})
+		go func() {
+			defer close(statusSent)
+			time.Sleep(200 * time.Millisecond)
+			atomic.StoreInt32(&ready, 1)
+			ws.WriteJSON(map[string]interface{}{"type": "status", "ready": true})
+		}()
+		first := true
+		for {
+			mt, data, err := ws.ReadMessage()
+			switch {
+			case err != nil:
+				return
+			case mt == websocket.BinaryMessage && atomic.LoadInt32(&ready) == 0:
+				result <- errors.New("audio sent during the warmup")
+				return
+			case mt == websocket.BinaryMessage && first && !bytes.HasPrefix(data, []byte("RIFF")):
+				result <- errors.New("audio sent without the WAV header")
+				return
+			case mt == websocket.BinaryMessage:
+				first = false
+			case bytes.Contains(data, []byte(`"eos"`)):
+				<-statusSent
+				ws.WriteJSON(map[string]interface{}{"type": "end", "reason": "normal"})
+				result <- nil
+				return
+			}
+		}
+	})
+
+	c, err := Dial(context.Background(), url, Options{Reconnect: 1, ReconnectBackoff: time.Millisecond, ChunkSize: 1000, OnEvent: func(Event) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	streamed := make(chan error, 1)
+	go func() { streamed <- c.Stream(context.Background(), pausedReader(testWAV(64000), 8000, shutdown)) }()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream not resumed")
+	}
+	if err := <-streamed; err != nil {
+		t.Errorf("stream failed: %v", err)
+	}
+}
+
+// Closing the client while Stream reconnects must neither deliver events on
+// the closed channel nor leave the new connection open.
+func TestCloseDuringReconnect(t *testing.T) {
+	shutdown := make(chan struct{})
+	dialed := make(chan struct{})
+	left := make(chan struct{})
+	url := fakeServer(t, func(n int, ws *websocket.Conn) {
+		ws.WriteJSON(map[string]interface{}{"type": "hello", "ready": n == 1})
+		if expect(ws, "start") != nil {
+			return
+		}
+		if n == 1 {
+			ws.WriteJSON(map[string]interface{}{"type": "end", "reason": "shutdown"})
+			close(shutdown)
+			return
+		}
+		close(dialed)    //never ready
+		ws.ReadMessage() //until the client closes the connection
+		close(left)
+	})
+
+	c, err := Dial(context.Background(), url, Options{Reconnect: 1, ReconnectBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range c.Events() {
+		}
+	}()
+	streamed := make(chan error, 1)
+	go func() { streamed <- c.Stream(context.Background(), pausedReader(testWAV(64000), 8000, shutdown)) }()
+	select {
+	case <-dialed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reconnection")
+	}
+	c.Close()
+	if err := <-streamed; err != ErrClosed {
+		t.Errorf("stream returned %v, want ErrClosed", err)
+	}
+	select {
+	case <-left:
+	case <-time.After(5 * time.Second):
+		t.Fatal("new connection left open")
+	}
+}
+
+func TestStreamRealtimeTinyRate(t *testing.T) {
+	url := fakeServer(t, func(n int, ws *websocket.Conn) {
+		ws.WriteJSON(map[string]interface{}{"type": "hello", "ready": true})
+		ws.ReadMessage()
+	})
+	c, err := Dial(context.Background(), url, Options{Realtime: true, BytesPerSecond: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	res := make(chan error, 1)
+	go func() { res <- c.Stream(context.Background(), bytes.NewReader(make([]byte, 100))) }()
+	select {
+	case err := <-res:
+		if err == nil {
+			t.Error("no error for a rate of 5 bytes per second")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream of a tiny rate did not return")
+	}
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Types of the events of the /v2/ws protocol, see flapi-v2.schema.json.
+const (
+	THello      = "hello"
+	TConfigured = "configured"
+	TStarted    = "started"
+	TStatus     = "status"
+	TSpeech     = "speech"
+	TPrediction = "prediction"
+	TRevision   = "revision"
+	TOverrun    = "overrun"
+	TError      = "error"
+	TPong       = "pong"
+	TEnd        = "end"
+
+	// TReconnected is not sent by the server: the client emits it after
+	// resuming a stream on a new connection.
+	TReconnected = "reconnected"
+)
+
+// Reasons of end events.
+const (
+	ReasonNormal       = "normal"
+	ReasonIdle         = "idle"
+	ReasonSlowConsumer = "slow_consumer"
+	ReasonPolicy       = "policy"
+	ReasonKicked       = "kicked"
+	ReasonShutdown     = "shutdown"
+	ReasonUnsupported  = "unsupported"
+	ReasonError        = "error"
+)
+
+// Header is common to all the events.
+type Header struct {
+	Seq  uint64 `json:"seq"` //sequence number within the connection
+	Type string `json:"type"`
+	Key  string `json:"key,omitempty"`
+}
+
+// EventHeader returns the header of the event.
+func (h Header) EventHeader() Header { return h }
+
+// Event is one of the event types below. Use a type switch to handle them.
+type Event interface {
+	EventHeader() Header
+}
+
+type Hello struct {
+	Header
+	Protocol string `json:"protocol"`
+	Ready    bool   `json:"ready"`
+}
+
+type Configured struct {
+	Header
+	Overflow string `json:"overflow"`
+	Speech   bool   `json:"speech"`
+}
+
+type Started struct {
+	Header
+	Session string `json:"session"`
+}
+
+type Status struct {
+	Header
+	Ready   bool   `json:"ready"`
+	Message string `json:"message"`
+}
+
+// Speech locates a segment of speech, in seconds since the start of the stream.
+type Speech struct {
+	Header
+	Segment uint    `json:"segment"`
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+}
+
+type Prediction struct {
+	Header
+	Segment uint   `json:"segment"`
+	Text    string `json:"text"`
+}
+
+// Revision replaces the predictions of all its segments with a single text.
+type Revision struct {
+	Header
+	Segments []uint `json:"segments"`
+	Text     string `json:"text"`
+}
+
+// Overrun reports audio lost by the server, because it couldn't keep up.
+type Overrun struct {
+	Header
+	Bytes   int     `json:"bytes"`
+	Seconds float64 `json:"seconds,omitempty"` //estimated duration of the lost audio, when known
+	Policy  string  `json:"policy"`
+}
+
+// ErrorEvent is an error reported by the server. Errors ending the session
+// are followed by an End event.
+type ErrorEvent struct {
+	Header
+	ID      string `json:"id,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ErrorEvent) Error() string {
+	return fmt.Sprintf("%v: %v", e.Code, e.Message)
+}
+
+type Pong struct {
+	Header
+	ID string `json:"id,omitempty"`
+}
+
+// End is the last event of a connection.
+type End struct {
+	Header
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// Reconnected tells that the stream resumed on a new connection, after Err.
+// The audio sent but not transcribed before the failure is lost.
+type Reconnected struct {
+	Header
+	Attempt int   `json:"attempt"`
+	Err     error `json:"-"`
+}
+
+// decodeEvent decodes a text message of the server.
+func decodeEvent(data []byte) (Event, error) {
+	var h Header
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, err
+	}
+	var e Event
+	switch h.Type {
+	case THello:
+		e = &Hello{}
+	case TConfigured:
+		e = &Configured{}
+	case TStarted:
+		e = &Started{}
+	case TStatus:
+		e = &Status{}
+	case TSpeech:
+		e = &Speech{}
+	case TPrediction:
+		e = &Prediction{}
+	case TRevision:
+		e = &Revision{}
+	case TOverrun:
+		e = &Overrun{}
+	case TError:
+		e = &ErrorEvent{}
+	case TPong:
+		e = &Pong{}
+	case TEnd:
+		e = &End{}
+	default:
+		return nil, fmt.Errorf("unknown event type '%v'", h.Type)
+	}
+	return e, json.Unmarshal(data, e)
+}
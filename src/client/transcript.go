@@ -0,0 +1,153 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Transcript assembles the events of a session into segments, applying
+// revisions. Segments without a Speech event have no times.
+type Transcript struct {
+	Segments []Segment `json:"segments"`
+}
+
+// Segment is a transcribed span of the audio. Segments merged by a revision
+// keep all their indices.
+type Segment struct {
+	Indices []uint  `json:"indices"`
+	Start   float64 `json:"start"` //seconds since the start of the stream
+	End     float64 `json:"end"`
+	Text    string  `json:"text"`
+}
+
+// find returns the position of the segment holding a segment index, or -1.
+func (t *Transcript) find(index uint) int {
+	for i := len(t.Segments) - 1; i >= 0; i-- {
+		for _, idx := range t.Segments[i].Indices {
+			if idx == index {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Apply updates the transcript with an event. Other events than Speech,
+// Prediction and Revision are ignored.
+func (t *Transcript) Apply(e Event) {
+	switch e := e.(type) {
+	case *Speech:
+		t.Segments = append(t.Segments, Segment{Indices: []uint{e.Segment}, Start: e.Start, End: e.End})
+	case *Prediction:
+		i := t.find(e.Segment)
+		if i == -1 { //speech events disabled
+			t.Segments = append(t.Segments, Segment{Indices: []uint{e.Segment}})
+			i = len(t.Segments) - 1
+		}
+		t.Segments[i].Text = strings.TrimSpace(e.Text)
+	case *Revision:
+		if len(e.Segments) == 0 {
+			return
+		}
+		first, last := t.find(e.Segments[0]), t.find(e.Segments[len(e.Segments)-1])
+		if first == -1 || last == -1 || last < first {
+			return
+		}
+		merged := Segment{
+			Indices: append([]uint(nil), e.Segments...),
+			Start:   t.Segments[first].Start,
+			End:     t.Segments[last].End,
+			Text:    strings.TrimSpace(e.Text),
+		}
+		t.Segments = append(t.Segments[:first], append([]Segment{merged}, t.Segments[last+1:]...)...)
+	}
+}
+
+// Text returns the text of the segments, separated with spaces.
+func (t *Transcript) Text() string {
+	var texts []string
+	for _, seg := range t.Segments {
+		if seg.Text != "" {
+			texts = append(texts, seg.Text)
+		}
+	}
+	return strings.Join(texts, " ")
+}
+
+// WriteText writes the text of the segments, one segment per line.
+func (t *Transcript) WriteText(w io.Writer) error {
+	for _, seg := range t.Segments {
+		if seg.Text == "" {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, seg.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the text and the segments as an indented JSON document.
+func (t *Transcript) WriteJSON(w io.Writer) error {
+	segments := t.Segments
+	if segments == nil {
+		segments = []Segment{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Text     string    `json:"text"`
+		Segments []Segment `json:"segments"`
+	}{t.Text(), segments})
+}
+
+// Writers are the transcript file formats, by file extension.
+var Writers = map[string]func(*Transcript, io.Writer) error{
+	"txt":  (*Transcript).WriteText,
+	"json": (*Transcript).WriteJSON,
+	"srt":  (*Transcript).WriteSRT,
+	"vtt":  (*Transcript).WriteVTT,
+}
+
+// timestamp formats seconds as hh:mm:ss followed by sep and milliseconds.
+func timestamp(seconds float64, sep string) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d",
+		int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, sep, d.Milliseconds()%1000)
+}
+
+// WriteSRT writes the segments with a text as SubRip subtitles.
+func (t *Transcript) WriteSRT(w io.Writer) error {
+	n := 0
+	for _, seg := range t.Segments {
+		if seg.Text == "" {
+			continue
+		}
+		n++
+		if _, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n",
+			n, timestamp(seg.Start, ","), timestamp(seg.End, ","), seg.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteVTT writes the segments with a text as WebVTT subtitles.
+func (t *Transcript) WriteVTT(w io.Writer) error {
+	if _, err := io.WriteString(w, "WEBVTT\n\n"); err != nil {
+		return err
+	}
+	for _, seg := range t.Segments {
+		if seg.Text == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s --> %s\n%s\n\n",
+			timestamp(seg.Start, "."), timestamp(seg.End, "."), seg.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
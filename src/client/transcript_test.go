@@ -0,0 +1,54 @@
+package client
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTranscriptApply(t *testing.T) {
+	var tr Transcript
+	for _, e := range []Event{
+		&Speech{Segment: 0, Start: 0, End: 1},
+		&Prediction{Segment: 0, Text: " hello "},
+		&Speech{Segment: 1, Start: 2, End: 3},
+		&Prediction{Segment: 1, Text: "word"},
+		&Prediction{Segment: 2, Text: "no speech event"},
+		&Revision{Segments: []uint{0, 1}, Text: "hello world"},
+		&Revision{Segments: []uint{2, 0}, Text: "out of order"},
+		&Revision{Segments: []uint{7, 8}, Text: "unknown segments"},
+	} {
+		tr.Apply(e)
+	}
+	want := []Segment{
+		{Indices: []uint{0, 1}, Start: 0, End: 3, Text: "hello world"},
+		{Indices: []uint{2}, Text: "no speech event"},
+	}
+	if !reflect.DeepEqual(tr.Segments, want) {
+		t.Errorf("got %+v\nwant %+v", tr.Segments, want)
+	}
+	if text := tr.Text(); text != "hello world no speech event" {
+		t.Errorf("text %q", text)
+	}
+}
+
+func TestTranscriptWriters(t *testing.T) {
+	tr := Transcript{Segments: []Segment{
+		{Indices: []uint{0}, Start: 0.5, End: 61.25, Text: "hello"},
+		{Indices: []uint{1}, Start: 62, End: 63},
+	}}
+	for format, want := range map[string]string{
+		"txt":  "hello\n",
+		"srt":  "1\n00:00:00,500 --> 00:01:01,250\nhello\n\n",
+		"vtt":  "WEBVTT\n\n00:00:00.500 --> 00:01:01.250\nhello\n\n",
+		"json": "{\n  \"text\": \"hello\",\n  \"segments\": [\n    {\n      \"indices\": [\n        0\n      ],\n      \"start\": 0.5,\n      \"end\": 61.25,\n      \"text\": \"hello\"\n    },\n    {\n      \"indices\": [\n        1\n      ],\n      \"start\": 62,\n      \"end\": 63,\n      \"text\": \"\"\n    }\n  ]\n}\n",
+	} {
+		var buf bytes.Buffer
+		if err := Writers[format](&tr, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Errorf("%v: got %q, want %q", format, buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Command fake-flashlight stands in for flashlight's fl_asr_tutorial_inference_ctc.
+// It speaks the same stdio protocol, without any model: it reads audio file
+// paths on stdin, and writes canned predictions on stderr. Flashlight's own
+// flags (--am_path=... etc.) are accepted and ignored; the behaviour of the
+// fake is set with --fake_* flags, usually through flashlight.extra_args.
+//
+// A script file holds one step per line, consumed in order for each input:
+//
+//	hello world           predict "hello world"
+//	!empty                predict an empty text
+//	!delay 2s good bye    decode for 2s, then predict "good bye"
+//	!crash                abort without answering, as on a fatal error
+//	!exit 3               exit with status 3 without answering
+//	!hang                 stop answering, without exiting
+//
+// Empty lines and lines starting with # are ignored. Once the script is
+// exhausted, it starts over, unless --fake_loop=false, in which case the
+// process exits normally.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	text       = flag.String("fake_text", "hello world", "prediction for every input, when there is no script")
+	scriptPath = flag.String("fake_script", "", "file of scripted steps, one per input")
+	loop       = flag.Bool("fake_loop", true, "start the script over once exhausted")
+	delay      = flag.Duration("fake_delay", 0, "decoding time of every input")
+	startup    = flag.Duration("fake_startup", 0, "time spent loading the models before the first input")
+	crashAfter = flag.Int("fake_crash_after", 0, "abort after this many predictions (0 never aborts)")
+	checkInput = flag.Bool("fake_check_input", true, "log an error for inputs that aren't readable WAV files")
+)
+
+const (
+	predictedOutputStr = `[Inference tutorial for CTC]: predicted output for `
+	waitingInputStr    = `[Inference tutorial for CTC]: Waiting the input in the format [audio_path]`
+)
+
+type step struct {
+	text  string
+	delay time.Duration
+	crash bool
+	exit  int //exit status, or -1
+	hang  bool
+}
+
+// logf writes a glog-formatted line on stderr, like flashlight does.
+func logf(severity byte, format string, args ...interface{}) {
+	now := time.Now()
+	fmt.Fprintf(os.Stderr, "%c%s %7d fake_flashlight.go:0] %s\n",
+		severity, now.Format("0102 15:04:05.000000"), os.Getpid(), fmt.Sprintf(format, args...))
+}
+
+func parseScript(name string) (steps []step, err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s := step{text: line, delay: *delay, exit: -1}
+		if strings.HasPrefix(line, "!") {
+			fields := strings.SplitN(line, " ", 3)
+			switch fields[0] {
+			case "!empty":
+				s.text = ""
+			case "!delay":
+				if len(fields) < 2 {
+					return nil, fmt.Errorf("%v:%d: missing duration", name, lineno)
+				}
+				if s.delay, err = time.ParseDuration(fields[1]); err != nil {
+					return nil, fmt.Errorf("%v:%d: %w", name, lineno, err)
+				}
+				s.text = ""
+				if len(fields) == 3 {
+					s.text = fields[2]
+				}
+			case "!crash":
+				s.crash = true
+			case "!exit":
+				if len(fields) < 2 {
+					return nil, fmt.Errorf("%v:%d: missing exit status", name, lineno)
+				}
+				if s.exit, err = strconv.Atoi(fields[1]); err != nil {
+					return nil, fmt.Errorf("%v:%d: %w", name, lineno, err)
+				}
+			case "!hang":
+				s.hang = true
+			default:
+				return nil, fmt.Errorf("%v:%d: unknown directive %v", name, lineno, fields[0])
+			}
+		}
+		steps = append(steps, s)
+	}
+	return steps, scanner.Err()
+}
+
+// parseFlags parses the --fake_* flags, and ignores flashlight's own flags.
+func parseFlags() (ignored []string) {
+	var own []string
+	for _, arg := range os.Args[1:] {
+		if name := strings.TrimLeft(arg, "-"); strings.HasPrefix(name, "fake_") || name == "h" || name == "help" {
+			own = append(own, arg)
+		} else {
+			ignored = append(ignored, arg)
+		}
+	}
+	flag.CommandLine.Parse(own)
+	return
+}
+
+// checkWAV tells whether the input looks like the WAV file flashlight expects.
+func checkWAV(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var header [12]byte
+	if _, err = f.Read(header[:]); err != nil {
+		return err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return fmt.Errorf("%v is not a WAV file", path)
+	}
+	return nil
+}
+
+func main() {
+	ignored := parseFlags()
+	steps := []step{{text: *text, delay: *delay, exit: -1}}
+	if *scriptPath != "" {
+		var err error
+		if steps, err = parseScript(*scriptPath); err != nil {
+			logf('F', "failed to read script: %v", err)
+			os.Exit(1)
+		}
+		if len(steps) == 0 {
+			logf('F', "empty script %v", *scriptPath)
+			os.Exit(1)
+		}
+	}
+
+	logf('I', "Gflags after parsing %v", strings.Join(ignored, " "))
+	logf('I', "[Inference tutorial for CTC]: Loading models (fake, %v)", *startup)
+	time.Sleep(*startup)
+
+	stdin := bufio.NewScanner(os.Stdin)
+	for i, predictions := 0, 0; ; i++ {
+		if i == len(steps) {
+			if !*loop {
+				logf('I', "script exhausted, exiting")
+				return
+			}
+			i = 0
+		}
+		s := steps[i]
+
+		logf('I', waitingInputStr)
+		if *crashAfter > 0 && predictions >= *crashAfter {
+			//flashlight only terminates a prediction with the next waiting line
+			logf('F', "scripted crash after %d predictions", predictions)
+			os.Exit(134)
+		}
+		if !stdin.Scan() {
+			return //stdin closed: clean exit, like flashlight
+		}
+		path := strings.TrimSpace(stdin.Text())
+		if *checkInput {
+			if err := checkWAV(path); err != nil {
+				logf('E', "failed to load %v: %v", path, err)
+			}
+		}
+
+		switch {
+		case s.hang:
+			logf('W', "hanging on %v", path)
+			//select{} would abort: the runtime detects that nothing can wake it up
+			time.Sleep(math.MaxInt64)
+		case s.crash:
+			logf('F', "scripted crash on %v", path)
+			os.Exit(134)
+		case s.exit >= 0:
+			logf('I', "scripted exit(%d) on %v", s.exit, path)
+			os.Exit(s.exit)
+		}
+
+		time.Sleep(s.delay)
+		logf('I', "%s%s", predictedOutputStr, path)
+		fmt.Fprintln(os.Stderr, s.text)
+		predictions++
+	}
+}
@@ -0,0 +1,244 @@
+// Command flapi-client streams a local audio file, or stdin, to a flapi server
+// and prints its transcript:
+//
+//	flapi-client -server ws://localhost:8080 -format srt talk.mp3 > talk.srt
+//	arecord -f S16_LE -r 16000 -c 1 | flapi-client -format jsonl -
+//
+// The text, srt and vtt outputs are written once the session ends, with the
+// revisions applied; jsonl prints the events as they arrive.
+//
+// It speaks the /v2/ws protocol, whose end-of-stream message gets the last
+// segment transcribed without trailing silence. With -protocol v1, for servers
+// older than /v2/ws, silence is appended to WAV input instead, and the session
+// is closed once the server stayed quiet for -linger; v1 has no speech
+// timings, so only the text and jsonl formats are available.
+//
+// On the first interrupt (Ctrl-C), the client stops sending audio and waits
+// for the remaining predictions; on the second, it exits right away.
+//
+// Exit status is 0 when the session ended normally, 1 on connection and
+// server errors, 2 on usage errors and 130 when interrupted twice.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"time"
+
+	"github.com/cowdude/flapi/src/client"
+)
+
+var (
+	server    = flag.String("server", envOr("FLAPI_SERVER", "ws://localhost:8080"), "URL of the flapi server (env FLAPI_SERVER)")
+	apiKey    = flag.String("key", os.Getenv("FLAPI_API_KEY"), "API key (env FLAPI_API_KEY)")
+	format    = flag.String("format", "text", "output format: text, jsonl, srt or vtt")
+	output    = flag.String("o", "-", "output file, - for stdout")
+	realtime  = flag.Bool("realtime", false, "send the audio at real-time speed instead of as fast as possible")
+	rate      = flag.Int("rate", 0, "bytes per second of -realtime streams, read from the header of WAV input when 0")
+	reconnect = flag.Int("reconnect", 0, "reconnect attempts after a connection failure")
+	overflow  = flag.String("overflow", "", "input overflow policy of the session: block, drop_oldest or reject (server default when empty)")
+	timeout   = flag.Duration("timeout", 2*time.Minute, "timeout of the connection, and of the wait for the ASR to be ready")
+	protocol  = flag.String("protocol", "v2", "protocol of the server: v2, or v1 for servers without /v2/ws")
+	silence   = flag.Duration("silence", time.Second, "v1: silence appended to WAV input, so that the last segment is transcribed")
+	linger    = flag.Duration("linger", 3*time.Second, "v1: wait for events after the audio, until the server stays quiet this long")
+)
+
+// session is a v2 client, or a v1Session.
+type session interface {
+	WaitReady(ctx context.Context) error
+	Stream(ctx context.Context, r io.Reader) error
+	Events() <-chan client.Event
+	Close() error
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] FILE|-\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+// stoppableReader returns io.EOF once stopped, ending the stream gracefully.
+type stoppableReader struct {
+	io.Reader
+	stopped int32
+}
+
+func (r *stoppableReader) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&r.stopped) != 0 {
+		return 0, io.EOF
+	}
+	return r.Reader.Read(p)
+}
+
+func (r *stoppableReader) Stop() { atomic.StoreInt32(&r.stopped, 1) }
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+	switch *format {
+	case "text", "jsonl", "srt", "vtt":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown output format '%v'\n", *format)
+		os.Exit(2)
+	}
+	switch *overflow {
+	case "", "block", "drop_oldest", "reject":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown overflow policy '%v'\n", *overflow)
+		os.Exit(2)
+	}
+	switch *protocol {
+	case "v2":
+	case "v1":
+		//v1 has no speech timings, configuration nor session to resume
+		if *format == "srt" || *format == "vtt" {
+			fmt.Fprintf(os.Stderr, "the %v format requires the v2 protocol\n", *format)
+			os.Exit(2)
+		}
+		if *reconnect != 0 || *overflow != "" {
+			fmt.Fprintln(os.Stderr, "-reconnect and -overflow require the v2 protocol")
+			os.Exit(2)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown protocol '%v'\n", *protocol)
+		os.Exit(2)
+	}
+	os.Exit(run(flag.Arg(0)))
+}
+
+func dial(ctx context.Context) (session, error) {
+	if *protocol == "v1" {
+		s, err := dialV1(ctx, *server, *apiKey)
+		if err != nil {
+			return nil, err
+		}
+		s.realtime, s.rate, s.silence, s.linger = *realtime, *rate, *silence, *linger
+		return s, nil
+	}
+	return client.Dial(ctx, *server, client.Options{
+		APIKey:         *apiKey,
+		Overflow:       *overflow,
+		Reconnect:      *reconnect,
+		Realtime:       *realtime,
+		BytesPerSecond: *rate,
+	})
+}
+
+func run(input string) int {
+	var in io.Reader = os.Stdin
+	if input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	out := io.Writer(os.Stdout)
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	src := &stoppableReader{Reader: in}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupted := int32(0)
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		fmt.Fprintln(os.Stderr, "interrupted: waiting for the remaining predictions, interrupt again to quit")
+		src.Stop()
+		<-sig
+		atomic.StoreInt32(&interrupted, 1)
+		cancel()
+	}()
+
+	dialCtx, dialCancel := context.WithTimeout(ctx, *timeout)
+	defer dialCancel()
+	c, err := dial(dialCtx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "connect: %v\n", err)
+		return 1
+	}
+	if err = c.WaitReady(dialCtx); err != nil {
+		c.Close()
+		fmt.Fprintf(os.Stderr, "waiting for the ASR: %v\n", err)
+		return 1
+	}
+
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- c.Stream(ctx, src)
+		c.Close()
+	}()
+
+	var transcript client.Transcript
+	enc := json.NewEncoder(out)
+	for e := range c.Events() {
+		transcript.Apply(e)
+		switch e := e.(type) {
+		case *client.ErrorEvent:
+			fmt.Fprintf(os.Stderr, "error: %v\n", e)
+		case *client.Overrun:
+			lost := fmt.Sprintf("%d bytes", e.Bytes)
+			if e.Seconds > 0 {
+				lost += fmt.Sprintf(" (~%.1fs)", e.Seconds)
+			}
+			fmt.Fprintf(os.Stderr, "overrun: %v lost (%v)\n", lost, e.Policy)
+		case *client.Reconnected:
+			fmt.Fprintf(os.Stderr, "reconnected (attempt %d) after: %v\n", e.Attempt, e.Err)
+		}
+		if *format == "jsonl" {
+			err = enc.Encode(e)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "output: %v\n", err)
+			return 1
+		}
+	}
+
+	switch *format {
+	case "text":
+		err = transcript.WriteText(out)
+	case "srt":
+		err = transcript.WriteSRT(out)
+	case "vtt":
+		err = transcript.WriteVTT(out)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "output: %v\n", err)
+		return 1
+	}
+	if atomic.LoadInt32(&interrupted) != 0 {
+		return 130
+	}
+	if err = <-streamErr; err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
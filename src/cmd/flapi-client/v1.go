@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/cowdude/flapi/src/client"
+	"github.com/gorilla/websocket"
+)
+
+// v1Session streams audio over the /v1/ws protocol, for servers without
+// /v2/ws. Its events are converted to those of the client package. The
+// protocol has no end-of-stream message: silence is appended to WAV input
+// instead, so that the last segment is transcribed, and the session is closed
+// once the server stayed quiet for the linger duration.
+type v1Session struct {
+	ws     *websocket.Conn
+	events chan client.Event
+	ready  chan struct{}
+	done   chan struct{} //closed when the reader exits; err is set beforehand
+	err    error
+	last   int64 //unix nanoseconds of the last event
+
+	realtime bool
+	rate     int           //bytes per second of realtime streams, read from the WAV header when 0
+	silence  time.Duration //appended to WAV input
+	linger   time.Duration //without events, after the audio, before closing
+}
+
+// Close codes of /v1/ws, and the matching reasons of v2 end events.
+var v1CloseReasons = map[int]string{
+	websocket.CloseNormalClosure:     client.ReasonNormal,
+	websocket.CloseGoingAway:         client.ReasonShutdown,
+	websocket.CloseUnsupportedData:   client.ReasonUnsupported,
+	websocket.ClosePolicyViolation:   client.ReasonPolicy,
+	websocket.CloseMessageTooBig:     client.ReasonError,
+	websocket.CloseInternalServerErr: client.ReasonError,
+	4000:                             client.ReasonIdle,
+	4001:                             client.ReasonSlowConsumer,
+}
+
+// v1URL returns the /v1/ws URL of a server, given as a base or full URL.
+func v1URL(server string) (string, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return "", fmt.Errorf("unsupported URL scheme '%v'", u.Scheme)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/ws"
+	}
+	return u.String(), nil
+}
+
+// dialV1 connects to the /v1/ws endpoint of a server. Unlike v2 sessions, the
+// connection isn't resumed after a failure.
+func dialV1(ctx context.Context, server, apiKey string) (*v1Session, error) {
+	u, err := v1URL(server)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if apiKey != "" {
+		header.Set("X-API-Key", apiKey)
+	}
+	ws, res, err := websocket.DefaultDialer.DialContext(ctx, u, header)
+	if err != nil {
+		if res != nil {
+			err = fmt.Errorf("%w (%v)", err, res.Status)
+		}
+		return nil, err
+	}
+	s := &v1Session{
+		ws:     ws,
+		events: make(chan client.Event, 64),
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+		last:   time.Now().UnixNano(),
+	}
+	go s.read()
+	return s, nil
+}
+
+// read is the reader goroutine: it converts the events of the server, and
+// closes the Events channel when the connection ends.
+func (s *v1Session) read() {
+	defer close(s.events)
+	defer close(s.done)
+	readyOnce := false
+	for {
+		_, data, err := s.ws.ReadMessage()
+		if err != nil {
+			end := &client.End{Header: client.Header{Type: client.TEnd}, Reason: client.ReasonError, Message: err.Error()}
+			var cerr *websocket.CloseError
+			if errors.As(err, &cerr) {
+				if reason, ok := v1CloseReasons[cerr.Code]; ok {
+					end.Reason = reason
+				}
+				end.Message = cerr.Text
+			}
+			if end.Reason != client.ReasonNormal {
+				s.err = &client.EndError{Reason: end.Reason, Message: end.Message}
+			}
+			s.events <- end
+			return
+		}
+		atomic.StoreInt64(&s.last, time.Now().UnixNano())
+		var msg struct {
+			Event   string
+			Result  json.RawMessage
+			Message string
+			Code    string
+		}
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		var e client.Event
+		switch msg.Event {
+		case "status_changed":
+			status := &client.Status{Header: client.Header{Type: client.TStatus}, Message: msg.Message}
+			json.Unmarshal(msg.Result, &status.Ready)
+			if status.Ready && !readyOnce {
+				readyOnce = true
+				close(s.ready)
+			}
+			e = status
+		case "prediction":
+			pred := &client.Prediction{Header: client.Header{Type: client.TPrediction}}
+			json.Unmarshal(msg.Result, pred)
+			e = pred
+		case "revision":
+			rev := &client.Revision{Header: client.Header{Type: client.TRevision}}
+			json.Unmarshal(msg.Result, rev)
+			e = rev
+		case "overrun":
+			overrun := &client.Overrun{Header: client.Header{Type: client.TOverrun}}
+			json.Unmarshal(msg.Result, overrun)
+			e = overrun
+		case "error":
+			e = &client.ErrorEvent{Header: client.Header{Type: client.TError}, Code: msg.Code, Message: msg.Message}
+		default:
+			continue
+		}
+		s.events <- e
+	}
+}
+
+func (s *v1Session) Events() <-chan client.Event {
+	return s.events
+}
+
+// WaitReady waits until the ASR of the server is ready to transcribe audio.
+func (s *v1Session) WaitReady(ctx context.Context) error {
+	select {
+	case <-s.ready:
+		return nil
+	case <-s.done:
+		if s.err != nil {
+			return s.err
+		}
+		return errors.New("connection closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes the connection.
+func (s *v1Session) Close() error {
+	s.ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second))
+	select {
+	case <-s.done:
+	case <-time.After(time.Second):
+	}
+	err := s.ws.Close()
+	<-s.done
+	return err
+}
+
+// Stream sends the audio of r followed by silence, as fast as possible or at
+// realtime speed, then waits for linger without any event from the server.
+func (s *v1Session) Stream(ctx context.Context, r io.Reader) error {
+	realtime, rate, linger := s.realtime, s.rate, s.linger
+	br := bufio.NewReaderSize(r, 4096)
+	peek, _ := br.Peek(4096)
+	wav, byteRate, blockAlign := parseWAVHeader(peek)
+	var silenceBytes int
+	if wav != nil {
+		silenceBytes = int(s.silence.Seconds()*float64(byteRate)) / blockAlign * blockAlign
+		growWAV(wav, silenceBytes)
+		if _, err := br.Discard(len(wav)); err != nil {
+			return err
+		}
+	} else if s.silence > 0 {
+		fmt.Fprintln(os.Stderr, "warning: no silence appended to non-WAV input, its last segment may not be transcribed")
+	}
+	if rate == 0 {
+		rate = byteRate
+	}
+	if realtime && rate < 10 {
+		return errors.New("real-time pacing requires -rate, of at least 10 bytes per second, for non-WAV input")
+	}
+	chunkSize := 16 << 10
+	if realtime && chunkSize > rate/10 {
+		chunkSize = rate / 10 //100ms messages
+	}
+
+	var (
+		chunk   = make([]byte, chunkSize)
+		sent    int
+		started = time.Now()
+	)
+	send := func(p []byte) error {
+		if realtime {
+			due := started.Add(time.Duration(float64(sent) / float64(rate) * float64(time.Second)))
+			select {
+			case <-time.After(time.Until(due)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		sent += len(p)
+		if err := s.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+			<-s.done
+			if s.err != nil {
+				return s.err
+			}
+			return err
+		}
+		return nil
+	}
+	if wav != nil {
+		if err := send(wav); err != nil {
+			return err
+		}
+	}
+	for {
+		n, rerr := br.Read(chunk)
+		if n > 0 {
+			if err := send(chunk[:n]); err != nil {
+				return err
+			}
+		}
+		if rerr == io.EOF {
+			break
+		} else if rerr != nil {
+			return rerr
+		}
+	}
+	for silenceBytes > 0 {
+		n := silenceBytes
+		if n > chunkSize {
+			n = chunkSize
+		}
+		if err := send(make([]byte, n)); err != nil {
+			return err
+		}
+		silenceBytes -= n
+	}
+
+	sentAt := time.Now()
+	for {
+		quiet := time.Since(time.Unix(0, atomic.LoadInt64(&s.last)))
+		if since := time.Since(sentAt); since < quiet {
+			quiet = since
+		}
+		if quiet >= linger {
+			return nil
+		}
+		select {
+		case <-time.After(linger - quiet):
+		case <-s.done:
+			return s.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// parseWAVHeader returns the header of WAV input, up to its data, along with
+// its byte rate and block alignment. It returns nil for other formats.
+func parseWAVHeader(peek []byte) (header []byte, byteRate, blockAlign int) {
+	if len(peek) < 12 || string(peek[:4]) != "RIFF" || string(peek[8:12]) != "WAVE" {
+		return nil, 0, 0
+	}
+	for off := 12; off+8 <= len(peek); {
+		id, size := string(peek[off:off+4]), int(binary.LittleEndian.Uint32(peek[off+4:off+8]))
+		switch id {
+		case "fmt ":
+			if off+22 <= len(peek) {
+				byteRate = int(binary.LittleEndian.Uint32(peek[off+16 : off+20]))
+				blockAlign = int(binary.LittleEndian.Uint16(peek[off+20 : off+22]))
+			}
+		case "data":
+			if byteRate == 0 || blockAlign == 0 {
+				return nil, 0, 0
+			}
+			return append([]byte(nil), peek[:off+8]...), byteRate, blockAlign
+		}
+		off += 8 + size + size%2
+	}
+	return nil, 0, 0
+}
+
+// growWAV adds n bytes to the data size of a WAV header, unless the size is
+// unknown (streams, such as arecord's output, declare the largest size).
+func growWAV(header []byte, n int) {
+	const unknown = 0x7FFFFFFF
+	dataSize := header[len(header)-4:]
+	if size := binary.LittleEndian.Uint32(dataSize); size < unknown-uint32(n) {
+		binary.LittleEndian.PutUint32(dataSize, size+uint32(n))
+		riffSize := binary.LittleEndian.Uint32(header[4:8])
+		binary.LittleEndian.PutUint32(header[4:8], riffSize+uint32(n))
+	}
+}
@@ -0,0 +1,253 @@
+// Command flapi-transcribe transcribes audio files in-process, without the
+// HTTP server: each file goes through the transcoder, the activity scanner
+// and a recognizer, and its transcript is written next to it as sidecar files
+// (talk.mp3 gets talk.txt, talk.json and talk.srt).
+//
+//	flapi-transcribe -config /config.yml -j 4 /archive/2021 /archive/2022/call.wav
+//
+// Directories are walked recursively for files with an audio extension. Files
+// whose sidecar files are all newer than them are skipped, so that an
+// interrupted run can be resumed by running it again. With the flashlight
+// engine, -j flashlight processes are started, and each one transcribes a
+// file at a time.
+//
+// Exit status is 0 when all the files were transcribed, 1 when some failed and
+// 2 on usage errors.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/cowdude/flapi/src/audio"
+	"github.com/cowdude/flapi/src/client"
+	"github.com/cowdude/flapi/src/recognizer"
+)
+
+var (
+	configPath = flag.String("config", "", "flapi config file, for its recognizer, flashlight and activity sections (defaults when empty)")
+	engine     = flag.String("engine", "", "overrides recognizer.engine of the config: flashlight, remote or stub")
+	jobs       = flag.Int("j", 1, "files transcribed in parallel; with flashlight, number of flashlight processes")
+	formatList = flag.String("formats", "txt,json,srt", "comma-separated sidecar files to write: txt, json, srt, vtt")
+	extList    = flag.String("ext", "wav,mp3,flac,ogg,opus,m4a,aac,webm,mp4", "comma-separated extensions of the audio files of directories")
+	force      = flag.Bool("force", false, "transcribe files again even when their sidecar files are up to date")
+	verbose    = flag.Bool("v", false, "enable debug logging")
+)
+
+// configuration is the subset of the flapi config used by the command.
+type configuration struct {
+	Recognizer struct {
+		Engine string
+		Remote recognizer.RemoteConfig
+		Stub   recognizer.StubConfig
+	}
+	Flashlight recognizer.FlashlightConfig
+	Activity   audio.ActivityOpts
+}
+
+func loadConfig(path string) (*configuration, error) {
+	cfg := new(configuration)
+	cfg.Recognizer.Engine = "flashlight"
+	cfg.Recognizer.Remote = recognizer.DefaultRemoteConfig()
+	cfg.Flashlight = recognizer.DefaultFlashlightConfig()
+	cfg.Activity = audio.DefaultActivityOpts()
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+	}
+	if *engine != "" {
+		cfg.Recognizer.Engine = *engine
+	}
+	switch cfg.Recognizer.Engine {
+	case "flashlight", "remote", "stub":
+	default:
+		return nil, fmt.Errorf("unknown recognizer engine '%v'", cfg.Recognizer.Engine)
+	}
+	return cfg, nil
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] FILE|DIR...\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 || *jobs < 1 {
+		usage()
+		os.Exit(2)
+	}
+	log.SetLevel(log.WarnLevel) //the scanner logs every file at info level
+	if *verbose {
+		log.SetLevel(log.DebugLevel)
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	formats := strings.Split(*formatList, ",")
+	for _, format := range formats {
+		if _, ok := client.Writers[format]; !ok {
+			fmt.Fprintf(os.Stderr, "unknown sidecar format '%v'\n", format)
+			os.Exit(2)
+		}
+	}
+	files, err := collect(flag.Args(), strings.Split(*extList, ","))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	pool := newPool(cfg, *jobs)
+	defer pool.Close()
+
+	var done, skipped, failed int64
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	for _, asr := range pool.workers {
+		wg.Add(1)
+		go func(asr recognizer.Recognizer) {
+			defer wg.Done()
+			for file := range queue {
+				if !*force && upToDate(file, formats) {
+					atomic.AddInt64(&skipped, 1)
+					continue
+				}
+				start := time.Now()
+				t, err := transcribe(ctx, asr, cfg.Activity, file)
+				if err == nil {
+					err = writeSidecars(file, t, formats)
+				}
+				if err != nil {
+					if ctx.Err() == nil {
+						log.WithField("file", file).Errorf("Failed: %v", err)
+						atomic.AddInt64(&failed, 1)
+					}
+					continue
+				}
+				atomic.AddInt64(&done, 1)
+				fmt.Printf("%v: %d segments, %.1fs of audio in %v\n",
+					file, len(t.Segments), t.Duration, time.Since(start).Round(time.Millisecond))
+			}
+		}(asr)
+	}
+feed:
+	for _, file := range files {
+		select {
+		case queue <- file:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	fmt.Printf("%d transcribed, %d up to date, %d failed", done, skipped, failed)
+	if n := int64(len(files)) - done - skipped - failed; n > 0 {
+		fmt.Printf(", %d interrupted", n)
+	}
+	fmt.Println()
+	if failed > 0 || ctx.Err() != nil {
+		os.Exit(1)
+	}
+}
+
+// collect returns the files of the arguments, walking directories for audio files.
+func collect(args, exts []string) (files []string, err error) {
+	isAudio := func(path string) bool {
+		ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		for _, e := range exts {
+			if ext == e {
+				return true
+			}
+		}
+		return false
+	}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && isAudio(path) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// pool holds the recognizers of the workers: a flashlight process per worker,
+// or a single recognizer shared by all the workers for the other engines.
+type pool struct {
+	workers []recognizer.Recognizer
+	owned   []recognizer.Recognizer
+}
+
+func newPool(cfg *configuration, n int) *pool {
+	p := new(pool)
+	start := func(asr recognizer.Recognizer) recognizer.Recognizer {
+		p.owned = append(p.owned, asr)
+		go func() {
+			if err := asr.Run(); err != nil && err != recognizer.ErrClosed {
+				log.WithError(err).Error("Recognizer exited")
+			}
+		}()
+		return asr
+	}
+	switch cfg.Recognizer.Engine {
+	case "flashlight":
+		for i := 0; i < n; i++ {
+			p.workers = append(p.workers, start(recognizer.NewFlashlight(func() recognizer.FlashlightConfig { return cfg.Flashlight })))
+		}
+		return p
+	case "remote":
+		start(recognizer.NewRemote(func() recognizer.RemoteConfig { return cfg.Recognizer.Remote }))
+	default:
+		start(recognizer.NewStub(func() recognizer.StubConfig { return cfg.Recognizer.Stub }))
+	}
+	for i := 0; i < n; i++ {
+		p.workers = append(p.workers, p.owned[0])
+	}
+	return p
+}
+
+func (p *pool) Close() {
+	for _, asr := range p.owned {
+		asr.Close()
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cowdude/flapi/src/audio"
+	"github.com/cowdude/flapi/src/client"
+	"github.com/cowdude/flapi/src/recognizer"
+)
+
+const sampleRate = 16000
+
+// transcript is the result of a file, written as is in the .json sidecar.
+type transcript struct {
+	File          string    `json:"file"`
+	Duration      float64   `json:"duration"` //seconds of audio
+	TranscribedAt time.Time `json:"transcribed_at"`
+	Text          string    `json:"text"`
+	client.Transcript
+}
+
+// countingReader counts the bytes read from the transcoder.
+type countingReader struct {
+	audio.AudioReader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.AudioReader.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return
+}
+
+// transcribe runs a file through the transcoder, the activity scanner and the
+// recognizer, one segment at a time.
+func transcribe(ctx context.Context, asr recognizer.Recognizer, opts audio.ActivityOpts, path string) (t *transcript, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	transcoder := audio.Transcode(ctx, f, audio.WAV, sampleRate)
+	pcm := &countingReader{AudioReader: transcoder}
+	info := make(chan audio.WAVEInfo, 1)
+	activity := make(chan audio.Activity, 1)
+	scanErr := make(chan error, 1)
+	go func() {
+		defer close(activity)
+		err := audio.ScanActivity(ctx, pcm, info, activity, opts)
+		if werr := transcoder.Close(); werr != nil && ctx.Err() == nil {
+			err = fmt.Errorf("transcoding: %w", werr)
+		}
+		scanErr <- err
+	}()
+	defer func() {
+		cancel()
+		for range activity {
+		}
+	}()
+
+	var format audio.WAVEInfo
+	select {
+	case format = <-info:
+	case err = <-scanErr:
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+
+	var segments client.Transcript
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var index uint
+	for event := range activity {
+		seg := recognizer.Segment{
+			Name:   fmt.Sprintf("%v_%04x", name, index),
+			Format: format,
+			Frames: event.Frames,
+		}
+		pred, err := asr.Recognize(ctx, seg, recognizer.Options{Session: name})
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %w", index, err)
+		}
+		segments.Apply(&client.Speech{Segment: index, Start: event.Start.Seconds(), End: (event.Start + event.Duration).Seconds()})
+		segments.Apply(&client.Prediction{Segment: index, Text: pred.Text})
+		index++
+	}
+	if err = <-scanErr; err != nil {
+		return
+	}
+	return &transcript{
+		File:          path,
+		Duration:      format.Duration(int(atomic.LoadInt64(&pcm.n))).Seconds(),
+		TranscribedAt: time.Now().UTC(),
+		Text:          segments.Text(),
+		Transcript:    segments,
+	}, nil
+}
+
+// writeSidecar writes a sidecar file. The .json sidecar also describes the
+// file, the other formats are the transcript files of the client package.
+func writeSidecar(w io.Writer, t *transcript, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t)
+	}
+	return client.Writers[format](&t.Transcript, w)
+}
+
+func sidecarPath(file, format string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + "." + format
+}
+
+// upToDate tells whether all the sidecar files of a file are newer than it.
+func upToDate(file string, formats []string) bool {
+	info, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+	for _, format := range formats {
+		sidecar, err := os.Stat(sidecarPath(file, format))
+		if err != nil || sidecar.ModTime().Before(info.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeSidecars writes the sidecar files of a file. Each file is written under
+// a temporary name first, so that interrupted runs don't leave partial files.
+func writeSidecars(file string, t *transcript, formats []string) error {
+	for _, format := range formats {
+		path := sidecarPath(file, format)
+		tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+		if err != nil {
+			return err
+		}
+		err = writeSidecar(tmp, t, format)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Chmod(tmp.Name(), 0644)
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return nil
+}
@@ -1,30 +1,72 @@
 package main
 
 import (
+	"crypto/sha256"
 	"flag"
+	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"regexp"
+	"sync/atomic"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/cowdude/flapi/src/audio"
+	"github.com/cowdude/flapi/src/recognizer"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
-var Config struct {
-	Flashlight struct {
-		Executable          string
-		AccousticModel      string `yaml:"accoustic_model"`
-		LanguageModel       string `yaml:"language_model"`
-		Tokens              string
-		Lexicon             string
-		BeamSize            int     `yaml:"beam_size"`             //The number of top hypothesis to preserve at each decoding step
-		BeamSizeToken       int     `yaml:"beam_size_token"`       //The number of top by acoustic model scores tokens set to be considered at each decoding step
-		BeamThreshold       int     `yaml:"beam_threshold"`        //Cut of hypothesis far away by the current score from the best hypothesis
-		LanguageModelWeight float64 `yaml:"language_model_weight"` //Language model weight to accumulate with acoustic model score
-		WordScore           float64 `yaml:"word_score"`            //Score to add when word finishes (lexicon-based beam search decoder only)
-	}
-	HTTP struct {
-		Listen string
+// Configuration is the service configuration, as read from config.yml.
+// A loaded Configuration is never modified: reloads swap it for a new one.
+type Configuration struct {
+	Recognizer struct {
+		Engine string                  //flashlight (default), remote or stub
+		Remote recognizer.RemoteConfig //settings of the remote engine, which forwards segments to other flapi instances
+		Stub   recognizer.StubConfig   //settings of the stub engine, which returns the same text for every segment
+	}
+	Flashlight recognizer.FlashlightConfig
+	HTTP       struct {
+		Listen       string
+		WriteTimeout time.Duration `yaml:"write_timeout"` //Slow clients are disconnected when an event can't be written in time
+		SendQueue    int           `yaml:"send_queue"`    //Maximum number of events waiting to be sent, per client
+
+		PingInterval   time.Duration `yaml:"ping_interval"`    //Delay between websocket pings
+		PongTimeout    time.Duration `yaml:"pong_timeout"`     //Connections are dropped when a pong is late by this duration
+		IdleTimeout    time.Duration `yaml:"idle_timeout"`     //Connections are closed after this duration without audio (0 disables)
+		MaxMessageSize int64         `yaml:"max_message_size"` //Maximum size of a client websocket message, in bytes
+
+		ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` //Time given to sessions to finish their pending segments on shutdown
+
+		TLS struct {
+			Cert     string //PEM certificate chain; TLS is disabled when empty
+			Key      string //PEM private key
+			ClientCA string `yaml:"client_ca"` //PEM client CA bundle; enables mutual TLS when set
+		}
+	}
+	GRPC struct {
+		Listen         string //Address of the gRPC server, disabled when empty
+		MaxMessageSize int    `yaml:"max_message_size"` //Max size of received messages, such as the files of RecognizeFile
+	}
+	Auth struct {
+		Keys []struct {
+			Key    string
+			Label  string
+			Limits *Limits //Overrides auth.limits for this key
+		}
+		Limits   Limits   //Default limits, per key label
+		KeysFile string   `yaml:"keys_file"` //Hashed API keys, one '<label> <sha256 hex>' per line
+		Origins  []string //Allowed websocket origins, wildcards accepted
+	}
+	Log struct {
+		Format string //text (default) or json
+	}
+	Admin struct {
+		Labels []string //labels of the API keys allowed to use the admin API (empty disables it)
+	}
+	Health struct {
+		MaxQueueDepth int `yaml:"max_queue_depth"` //Readiness fails once this many segments wait for the ASR (0 disables)
 	}
 	Warmup *struct {
 		Audio       string
@@ -32,12 +74,90 @@ var Config struct {
 		Repeat      int
 	}
 
+	Input struct {
+		BufferSize int                  `yaml:"buffer_size"` //Maximum amount of buffered input bytes, per client
+		Overflow   audio.OverflowPolicy //What to do with incoming audio once the buffer is full
+	}
+
 	Activity audio.ActivityOpts
+	Revision struct {
+		Window      int           //Number of recent segments re-decoded together after each segment, merged ones included (<2 disables revisions)
+		MaxDuration time.Duration `yaml:"max_duration"` //Upper bound on the concatenated audio fed to the ASR
+	}
+	Watch struct {
+		Dirs         []string      //Directories polled for new audio files (empty disables watch folders)
+		Output       string        //Directory of the transcripts; each watched directory's done/ subfolder when empty
+		Formats      []string      //Transcript files written per audio file: txt, json, srt, vtt
+		Extensions   []string      //Extensions of the audio files picked up, other files are ignored
+		PollInterval time.Duration `yaml:"poll_interval"` //Delay between two scans of the directories
+		Settle       time.Duration //Files are picked up once their size and mtime are unchanged for this duration
+		Concurrency  int           //Files transcribed in parallel
+		Limits       Limits        //Quotas of the watch folders, accounted under the watchKeyLabel label
+	}
+	Jobs struct {
+		Dir           string        //Directory of the job store; the jobs API is disabled when empty
+		MaxUploadSize int64         `yaml:"max_upload_size"` //Maximum size of the audio file of a job, in bytes
+		Concurrency   int           //Jobs transcribed in parallel
+		Retention     time.Duration //Finished jobs are deleted after this duration (0 keeps them)
+	}
+
+	keyring   map[[sha256.Size]byte]string
+	keyLimits map[string]Limits
 }
 
 var configPath = flag.String("config", "config.yml", "Path to config.yml file")
 
-func LoadConfig() {
+var currentConfig atomic.Value
+
+// Config returns the current configuration. Sessions keep the configuration
+// they started with, while new sessions pick up reloaded configurations.
+func Config() *Configuration {
+	return currentConfig.Load().(*Configuration)
+}
+
+// defaultConfig returns the configuration used for settings missing from the config file.
+func defaultConfig() *Configuration {
+	cfg := new(Configuration)
+	cfg.Recognizer.Engine = "flashlight"
+	cfg.Recognizer.Remote = recognizer.DefaultRemoteConfig()
+	cfg.Flashlight = recognizer.DefaultFlashlightConfig()
+
+	cfg.HTTP.Listen = ":8080"
+	cfg.HTTP.WriteTimeout = 10 * time.Second
+	cfg.HTTP.SendQueue = 64
+	cfg.HTTP.PingInterval = 30 * time.Second
+	cfg.HTTP.PongTimeout = 15 * time.Second
+	cfg.HTTP.IdleTimeout = 5 * time.Minute
+	cfg.HTTP.MaxMessageSize = 1 << 20
+	cfg.HTTP.ShutdownTimeout = 30 * time.Second
+
+	cfg.GRPC.MaxMessageSize = 32 << 20
+
+	cfg.Log.Format = "text"
+	cfg.Health.MaxQueueDepth = 16
+
+	cfg.Input.BufferSize = 1 << 20
+	cfg.Input.Overflow = audio.Block
+
+	cfg.Activity = audio.DefaultActivityOpts()
+	cfg.Revision.MaxDuration = 10 * time.Second
+
+	cfg.Watch.Formats = []string{"txt", "json"}
+	cfg.Watch.Extensions = []string{"wav", "mp3", "flac", "ogg", "opus", "m4a", "aac", "webm", "mp4"}
+	cfg.Watch.PollInterval = 2 * time.Second
+	cfg.Watch.Settle = 2 * time.Second
+	cfg.Watch.Concurrency = 1
+
+	cfg.Jobs.MaxUploadSize = 1 << 30
+	cfg.Jobs.Concurrency = 1
+	cfg.Jobs.Retention = 7 * 24 * time.Hour
+	return cfg
+}
+
+// LoadConfig reads and validates the config file, without applying it.
+// Settings missing from the file get their default value, and FLAPI_*
+// environment variables override the settings of the file.
+func LoadConfig() (cfg *Configuration, err error) {
 	if *configPath == "" {
 		flag.PrintDefaults()
 		os.Exit(1)
@@ -45,11 +165,79 @@ func LoadConfig() {
 
 	f, err := os.Open(*configPath)
 	if err != nil {
-		log.Fatal("Failed to open config file: ", err)
+		return nil, fmt.Errorf("failed to open config file: %w", err)
 	}
 	defer f.Close()
 
-	if err = yaml.NewDecoder(f).Decode(&Config); err != nil {
-		log.Fatal("Failed to parse config file: ", err)
+	cfg = defaultConfig()
+	dec := yaml.NewDecoder(f)
+	dec.SetStrict(true) //typos would silently fall back to the defaults
+	if err = dec.Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to parse config file: %w", unknownSettings(err))
+	}
+	if err = applyEnvOverrides(cfg); err != nil {
+		return nil, err
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.keyring, cfg.keyLimits, err = loadKeyring(cfg); err != nil {
+		return nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
+	return
+}
+
+var unknownFieldRe = regexp.MustCompile(`^(line \d+): field (\S+) not found in type .*$`)
+
+// unknownSettings rewrites the errors of the strict decoder about unknown
+// fields, which otherwise name the (anonymous) struct types they're missing from.
+func unknownSettings(err error) error {
+	terr, ok := err.(*yaml.TypeError)
+	if !ok {
+		return err
+	}
+	msgs := make([]string, len(terr.Errors))
+	for i, msg := range terr.Errors {
+		msgs[i] = unknownFieldRe.ReplaceAllString(msg, "$1: unknown setting '$2'")
+	}
+	return &yaml.TypeError{Errors: msgs}
+}
+
+// ReloadConfig reads the config file again, and applies it to new sessions.
+// Settings of the HTTP listener need a restart; decoder settings restart the
+// ASR process. An invalid file is rejected, leaving the current config as is.
+func ReloadConfig() error {
+	next, err := LoadConfig()
+	if err != nil {
+		log.WithError(err).Error("Config reload rejected")
+		return err
+	}
+	prev := Config()
+	if next.HTTP.Listen != prev.HTTP.Listen || next.HTTP.TLS != prev.HTTP.TLS {
+		log.Warn("http.listen and http.tls changes require a restart, keeping the current listener")
+	}
+	if next.GRPC != prev.GRPC {
+		log.Warn("grpc changes require a restart, keeping the current gRPC server")
+	}
+	if !reflect.DeepEqual(next.Watch, prev.Watch) {
+		log.Warn("watch changes require a restart, keeping the current watch folders")
+	}
+	if next.Jobs.Dir != prev.Jobs.Dir || next.Jobs.Concurrency != prev.Jobs.Concurrency {
+		log.Warn("jobs.dir and jobs.concurrency changes require a restart, keeping the current job store")
+	}
+	if err = setupLogging(next); err != nil {
+		log.WithError(err).Error("Config reload rejected")
+		return err
+	}
+	currentConfig.Store(next)
+	log.Printf("Config reloaded, %d API key(s)", len(next.keyring))
+
+	if next.Recognizer.Engine != prev.Recognizer.Engine {
+		log.Warn("recognizer.engine changes require a restart, keeping the current engine")
+	}
+	if !reflect.DeepEqual(next.Flashlight, prev.Flashlight) && asr != nil {
+		log.Println("Decoder settings changed, restarting the ASR process")
+		asr.Restart()
 	}
+	return nil
 }
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/cowdude/flapi/src/audio"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const envPrefix = "FLAPI"
+
+// yamlName returns the key of a struct field in the config file.
+func yamlName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// applyEnvOverrides sets the config fields that have a matching environment
+// variable. Variable names are the upper-cased path of the setting in the
+// config file, such as FLAPI_HTTP_LISTEN or FLAPI_ACTIVITY_THRESHOLD.
+// Values are parsed as YAML, so that lists and sections can also be set:
+// FLAPI_AUTH_ORIGINS='[https://a.example.com, https://b.example.com]'.
+func applyEnvOverrides(cfg *Configuration) error {
+	return applyEnv(reflect.ValueOf(cfg).Elem(), envPrefix)
+}
+
+func applyEnv(v reflect.Value, name string) error {
+	if value, ok := os.LookupEnv(name); ok && name != envPrefix {
+		if err := yaml.Unmarshal([]byte(value), v.Addr().Interface()); err != nil {
+			return fmt.Errorf("invalid value for %v: %w", name, err)
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return nil
+		}
+		if v.IsNil() {
+			//only allocate optional sections when one of their settings is set
+			if !hasEnvPrefix(name + "_") {
+				return nil
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return applyEnv(v.Elem(), name)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue //unexported
+			}
+			key := strings.ToUpper(name + "_" + yamlName(field))
+			if err := applyEnv(v.Field(i), key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasEnvPrefix(prefix string) bool {
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type configErrors []string
+
+func (errs *configErrors) check(ok bool, setting, format string, args ...interface{}) {
+	if !ok {
+		*errs = append(*errs, fmt.Sprintf("%v: %v", setting, fmt.Sprintf(format, args...)))
+	}
+}
+
+func (errs *configErrors) checkFile(setting, name string) {
+	if name == "" {
+		errs.check(false, setting, "missing file path")
+		return
+	}
+	st, err := os.Stat(name)
+	if err != nil {
+		errs.check(false, setting, "%v", err)
+		return
+	}
+	errs.check(st.Mode().IsRegular(), setting, "%v is not a regular file", name)
+}
+
+func (errs *configErrors) checkDir(setting, name string) {
+	st, err := os.Stat(name)
+	if err != nil {
+		errs.check(false, setting, "%v", err)
+		return
+	}
+	errs.check(st.IsDir(), setting, "%v is not a directory", name)
+}
+
+// Validate checks that the configuration is usable: required files exist,
+// and settings are within sane ranges. All problems are reported at once.
+func (cfg *Configuration) Validate() error {
+	var errs configErrors
+
+	switch cfg.Recognizer.Engine {
+	case "flashlight":
+		fl := cfg.Flashlight
+		errs.checkFile("flashlight.executable", fl.Executable)
+		if st, err := os.Stat(fl.Executable); err == nil {
+			errs.check(st.Mode()&0111 != 0, "flashlight.executable", "%v is not executable", fl.Executable)
+		}
+		//model paths may be set to "" explicitly, for stand-ins that don't need them
+		for _, model := range []struct{ setting, name string }{
+			{"flashlight.accoustic_model", fl.AccousticModel},
+			{"flashlight.language_model", fl.LanguageModel},
+			{"flashlight.tokens", fl.Tokens},
+			{"flashlight.lexicon", fl.Lexicon},
+		} {
+			if model.name != "" {
+				errs.checkFile(model.setting, model.name)
+			}
+		}
+		errs.check(fl.BeamSize > 0, "flashlight.beam_size", "must be positive, got %v", fl.BeamSize)
+		errs.check(fl.BeamSizeToken > 0, "flashlight.beam_size_token", "must be positive, got %v", fl.BeamSizeToken)
+		errs.check(fl.BeamThreshold > 0, "flashlight.beam_threshold", "must be positive, got %v", fl.BeamThreshold)
+	case "remote":
+		r := cfg.Recognizer.Remote
+		errs.check(len(r.Upstreams) != 0, "recognizer.remote.upstreams", "at least one upstream is required")
+		seen := make(map[string]bool)
+		for i, upstream := range r.Upstreams {
+			u, err := url.Parse(upstream)
+			setting := fmt.Sprintf("recognizer.remote.upstreams[%d]", i)
+			errs.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				setting, "must be an http(s) URL, got '%v'", upstream)
+			errs.check(!seen[upstream], setting, "duplicate upstream '%v'", upstream)
+			seen[upstream] = true
+		}
+		errs.check(r.Timeout >= 0, "recognizer.remote.timeout", "must not be negative, got %v", r.Timeout)
+		errs.check(r.Retries >= 0, "recognizer.remote.retries", "must not be negative, got %v", r.Retries)
+		errs.check(r.RetryBackoff >= 0, "recognizer.remote.retry_backoff", "must not be negative, got %v", r.RetryBackoff)
+		errs.check(r.FailureCooldown >= 0, "recognizer.remote.failure_cooldown", "must not be negative, got %v", r.FailureCooldown)
+	case "stub":
+		errs.check(cfg.Recognizer.Stub.Delay >= 0, "recognizer.stub.delay", "must not be negative, got %v", cfg.Recognizer.Stub.Delay)
+	default:
+		errs.check(false, "recognizer.engine", "must be flashlight, remote or stub, got '%v'", cfg.Recognizer.Engine)
+	}
+
+	h := cfg.HTTP
+	errs.check(h.Listen != "", "http.listen", "missing listen address")
+	errs.check(h.WriteTimeout > 0, "http.write_timeout", "must be positive, got %v", h.WriteTimeout)
+	errs.check(h.SendQueue > 0, "http.send_queue", "must be positive, got %v", h.SendQueue)
+	errs.check(h.PingInterval > 0, "http.ping_interval", "must be positive, got %v", h.PingInterval)
+	errs.check(h.PongTimeout > 0, "http.pong_timeout", "must be positive, got %v", h.PongTimeout)
+	errs.check(h.IdleTimeout >= 0, "http.idle_timeout", "must not be negative, got %v", h.IdleTimeout)
+	errs.check(h.MaxMessageSize > 0, "http.max_message_size", "must be positive, got %v", h.MaxMessageSize)
+	errs.check(h.ShutdownTimeout >= 0, "http.shutdown_timeout", "must not be negative, got %v", h.ShutdownTimeout)
+	if h.TLS.Cert != "" || h.TLS.Key != "" {
+		errs.checkFile("http.tls.cert", h.TLS.Cert)
+		errs.checkFile("http.tls.key", h.TLS.Key)
+	}
+	if h.TLS.ClientCA != "" {
+		errs.check(h.TLS.Cert != "", "http.tls.client_ca", "requires http.tls.cert and http.tls.key")
+		errs.checkFile("http.tls.client_ca", h.TLS.ClientCA)
+	}
+
+	errs.check(cfg.GRPC.MaxMessageSize > 0, "grpc.max_message_size", "must be positive, got %v", cfg.GRPC.MaxMessageSize)
+
+	for i, key := range cfg.Auth.Keys {
+		errs.check(key.Key != "", fmt.Sprintf("auth.keys[%d].key", i), "missing key")
+		errs.check(key.Label != "", fmt.Sprintf("auth.keys[%d].label", i), "missing label")
+	}
+	if cfg.Auth.KeysFile != "" {
+		errs.checkFile("auth.keys_file", cfg.Auth.KeysFile)
+	}
+
+	for i, label := range cfg.Admin.Labels {
+		errs.check(label != "", fmt.Sprintf("admin.labels[%d]", i), "empty label")
+	}
+	errs.check(len(cfg.Admin.Labels) == 0 || len(cfg.Auth.Keys) != 0 || cfg.Auth.KeysFile != "", "admin.labels",
+		"the admin API requires auth.keys or auth.keys_file")
+
+	errs.check(cfg.Log.Format == "text" || cfg.Log.Format == "json", "log.format",
+		"must be text or json, got '%v'", cfg.Log.Format)
+	errs.check(cfg.Health.MaxQueueDepth >= 0, "health.max_queue_depth", "must not be negative")
+
+	if w := cfg.Warmup; w != nil {
+		errs.checkFile("warmup.audio", w.Audio)
+		errs.check(w.Repeat > 0, "warmup.repeat", "must be positive, got %v", w.Repeat)
+	}
+
+	errs.check(cfg.Input.BufferSize > 0, "input.buffer_size", "must be positive, got %v", cfg.Input.BufferSize)
+	switch cfg.Input.Overflow {
+	case audio.Block, audio.DropOldest, audio.Reject:
+	default:
+		errs.check(false, "input.overflow", "unknown policy '%v'", cfg.Input.Overflow)
+	}
+
+	a := cfg.Activity
+	errs.check(a.Threshold > 0 && a.Threshold < 1, "activity.threshold", "must be within ]0;1[ (or ]-inf;0[ dB), got %v", a.Threshold)
+	errs.check(a.GainSmooth >= 0 && a.GainSmooth < 1, "activity.gain_smooth", "must be within [0;1[, got %v", a.GainSmooth)
+	errs.check(a.ActivityTimeout > 0, "activity.timeout", "must be positive, got %v", a.ActivityTimeout)
+	errs.check(a.BufferDuration > a.ActivityTimeout+a.ContextPrefix, "activity.buffer_duration",
+		"must be longer than activity.timeout + activity.context_prefix, got %v", a.BufferDuration)
+	errs.check(a.ContextPrefix >= 0, "activity.context_prefix", "must not be negative, got %v", a.ContextPrefix)
+
+	errs.check(cfg.Revision.Window >= 0, "revision.window", "must not be negative, got %v", cfg.Revision.Window)
+	errs.check(cfg.Revision.MaxDuration >= 0, "revision.max_duration", "must not be negative, got %v", cfg.Revision.MaxDuration)
+
+	w := cfg.Watch
+	for _, dir := range w.Dirs {
+		errs.checkDir("watch.dirs", dir)
+	}
+	if w.Output != "" {
+		errs.checkDir("watch.output", w.Output)
+	}
+	for _, format := range w.Formats {
+		_, ok := transcriptWriters[format]
+		errs.check(ok, "watch.formats", "unknown format '%v', expected txt, json, srt or vtt", format)
+	}
+	errs.check(len(w.Dirs) == 0 || len(w.Formats) != 0, "watch.formats", "at least one format is required")
+	errs.check(len(w.Dirs) == 0 || len(w.Extensions) != 0, "watch.extensions", "at least one extension is required")
+	errs.check(w.PollInterval > 0, "watch.poll_interval", "must be positive, got %v", w.PollInterval)
+	errs.check(w.Settle >= 0, "watch.settle", "must not be negative, got %v", w.Settle)
+	errs.check(w.Concurrency > 0, "watch.concurrency", "must be positive, got %v", w.Concurrency)
+
+	j := cfg.Jobs
+	errs.check(j.MaxUploadSize > 0, "jobs.max_upload_size", "must be positive, got %v", j.MaxUploadSize)
+	errs.check(j.Concurrency > 0, "jobs.concurrency", "must be positive, got %v", j.Concurrency)
+	errs.check(j.Retention >= 0, "jobs.retention", "must not be negative, got %v", j.Retention)
+
+	if len(errs) != 0 {
+		return errors.New("invalid config:\n  " + strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// printConfig writes the effective configuration as YAML, without API keys.
+func printConfig(cfg *Configuration) error {
+	redacted := *cfg
+	redacted.Auth.Keys = append(redacted.Auth.Keys[:0:0], cfg.Auth.Keys...)
+	for i := range redacted.Auth.Keys {
+		redacted.Auth.Keys[i].Key = "<redacted>"
+	}
+	if redacted.Recognizer.Remote.APIKey != "" {
+		redacted.Recognizer.Remote.APIKey = "<redacted>"
+	}
+	out, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
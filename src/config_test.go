@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestLoadConfigUnknownSetting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	err := os.WriteFile(path, []byte("recognizer: {engine: stub}\nhttp:\n  idle_timout: 1m\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := *configPath
+	*configPath = path
+	defer func() { *configPath = prev }()
+
+	_, err = LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), "line 3: unknown setting 'idle_timout'") {
+		t.Fatalf("expected an unknown setting error, got %v", err)
+	}
+}
+
+// The sample config documents every setting: it must only use known ones.
+func TestSampleConfigKnownSettings(t *testing.T) {
+	f, err := os.Open("../config.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.SetStrict(true)
+	if err = dec.Decode(defaultConfig()); err != nil {
+		t.Fatal(unknownSettings(err))
+	}
+}
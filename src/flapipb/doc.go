@@ -0,0 +1,4 @@
+// Package flapipb holds the gRPC service of flapi, generated from flapi.proto.
+package flapipb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative flapi.proto
@@ -0,0 +1,178 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package flapipb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// SpeechClient is the client API for Speech service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SpeechClient interface {
+	// Recognize transcribes an audio stream, in any format ffmpeg can decode.
+	// Closing the send side of the call ends the input: the server sends the
+	// events of the remaining segments, then ends the call.
+	Recognize(ctx context.Context, opts ...grpc.CallOption) (Speech_RecognizeClient, error)
+	// RecognizeFile transcribes a whole file, in any format ffmpeg can decode.
+	RecognizeFile(ctx context.Context, in *RecognizeFileRequest, opts ...grpc.CallOption) (*RecognizeFileResponse, error)
+}
+
+type speechClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSpeechClient(cc grpc.ClientConnInterface) SpeechClient {
+	return &speechClient{cc}
+}
+
+func (c *speechClient) Recognize(ctx context.Context, opts ...grpc.CallOption) (Speech_RecognizeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Speech_ServiceDesc.Streams[0], "/flapi.v1.Speech/Recognize", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &speechRecognizeClient{stream}
+	return x, nil
+}
+
+type Speech_RecognizeClient interface {
+	Send(*AudioChunk) error
+	Recv() (*RecognitionEvent, error)
+	grpc.ClientStream
+}
+
+type speechRecognizeClient struct {
+	grpc.ClientStream
+}
+
+func (x *speechRecognizeClient) Send(m *AudioChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *speechRecognizeClient) Recv() (*RecognitionEvent, error) {
+	m := new(RecognitionEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *speechClient) RecognizeFile(ctx context.Context, in *RecognizeFileRequest, opts ...grpc.CallOption) (*RecognizeFileResponse, error) {
+	out := new(RecognizeFileResponse)
+	err := c.cc.Invoke(ctx, "/flapi.v1.Speech/RecognizeFile", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SpeechServer is the server API for Speech service.
+// All implementations must embed UnimplementedSpeechServer
+// for forward compatibility
+type SpeechServer interface {
+	// Recognize transcribes an audio stream, in any format ffmpeg can decode.
+	// Closing the send side of the call ends the input: the server sends the
+	// events of the remaining segments, then ends the call.
+	Recognize(Speech_RecognizeServer) error
+	// RecognizeFile transcribes a whole file, in any format ffmpeg can decode.
+	RecognizeFile(context.Context, *RecognizeFileRequest) (*RecognizeFileResponse, error)
+	mustEmbedUnimplementedSpeechServer()
+}
+
+// UnimplementedSpeechServer must be embedded to have forward compatible implementations.
+type UnimplementedSpeechServer struct {
+}
+
+func (UnimplementedSpeechServer) Recognize(Speech_RecognizeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Recognize not implemented")
+}
+func (UnimplementedSpeechServer) RecognizeFile(context.Context, *RecognizeFileRequest) (*RecognizeFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RecognizeFile not implemented")
+}
+func (UnimplementedSpeechServer) mustEmbedUnimplementedSpeechServer() {}
+
+// UnsafeSpeechServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SpeechServer will
+// result in compilation errors.
+type UnsafeSpeechServer interface {
+	mustEmbedUnimplementedSpeechServer()
+}
+
+func RegisterSpeechServer(s grpc.ServiceRegistrar, srv SpeechServer) {
+	s.RegisterService(&Speech_ServiceDesc, srv)
+}
+
+func _Speech_Recognize_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SpeechServer).Recognize(&speechRecognizeServer{stream})
+}
+
+type Speech_RecognizeServer interface {
+	Send(*RecognitionEvent) error
+	Recv() (*AudioChunk, error)
+	grpc.ServerStream
+}
+
+type speechRecognizeServer struct {
+	grpc.ServerStream
+}
+
+func (x *speechRecognizeServer) Send(m *RecognitionEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *speechRecognizeServer) Recv() (*AudioChunk, error) {
+	m := new(AudioChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Speech_RecognizeFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecognizeFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpeechServer).RecognizeFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/flapi.v1.Speech/RecognizeFile",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpeechServer).RecognizeFile(ctx, req.(*RecognizeFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Speech_ServiceDesc is the grpc.ServiceDesc for Speech service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Speech_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "flapi.v1.Speech",
+	HandlerType: (*SpeechServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RecognizeFile",
+			Handler:    _Speech_RecognizeFile_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Recognize",
+			Handler:       _Speech_Recognize_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "flapi.proto",
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+
+	"github.com/cowdude/flapi/src/audio"
+	"github.com/cowdude/flapi/src/flapipb"
+	"github.com/cowdude/flapi/src/recognizer"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var grpcServer *grpc.Server
+
+// grpcCodes maps the reasons sessions end to gRPC status codes.
+var grpcCodes = map[EndReason]codes.Code{
+	EndNormal:       codes.OK,
+	EndIdle:         codes.DeadlineExceeded,
+	EndSlowConsumer: codes.ResourceExhausted,
+	EndPolicy:       codes.ResourceExhausted,
+	EndKicked:       codes.Aborted,
+	EndShutdown:     codes.Unavailable,
+	EndUnsupported:  codes.InvalidArgument,
+	EndError:        codes.Internal,
+}
+
+// speechServer implements the gRPC Speech service on top of sessions, like the websocket.
+type speechServer struct {
+	flapipb.UnimplementedSpeechServer
+}
+
+// newGRPCServer returns the gRPC server, with the TLS settings of the HTTP server.
+func newGRPCServer(cfg *Configuration) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(cfg.GRPC.MaxMessageSize),
+	}
+	if cfg.HTTP.TLS.Cert != "" {
+		tlsConfig, err := newTLSConfig("h2")
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	flapipb.RegisterSpeechServer(server, &speechServer{})
+	return server, nil
+}
+
+func serveGRPC(server *grpc.Server, listen string) {
+	lis, err := net.Listen("tcp", listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("grpc listening on %v", listen)
+	if err = server.Serve(lis); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// grpcAuthenticate returns the label of the API key of a call, and the address of the client.
+func grpcAuthenticate(ctx context.Context) (label, remote string, err error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		remote = p.Addr.String()
+	}
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-api-key"); len(values) != 0 {
+		token = values[0]
+	} else if values := md.Get("authorization"); len(values) != 0 && strings.HasPrefix(values[0], "Bearer ") {
+		token = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	if label, err = lookupKey(token); err != nil {
+		log.WithField("remote", remote).Warnf("auth: %v", err)
+		return "", remote, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return
+}
+
+// startSession checks the call, and starts its session. The returned release
+// function must be called once the session is closed.
+func startSession(ctx context.Context, overflow audio.OverflowPolicy) (s *Session, release func(), err error) {
+	if isDraining() {
+		return nil, nil, status.Error(codes.Unavailable, "server shutting down")
+	}
+	label, remote, err := grpcAuthenticate(ctx)
+	if err != nil {
+		return
+	}
+	if err = acquireSession(label); err != nil {
+		log.WithField("key", label).Warnf("session rejected: %v", err)
+		return nil, nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	s = NewSession(ctx, SessionOptions{
+		Transport: "grpc",
+		Remote:    remote,
+		KeyLabel:  label,
+		Overflow:  overflow,
+	})
+	registerSession(s)
+	release = func() {
+		unregisterSession(s)
+		releaseSession(label)
+	}
+	return
+}
+
+// endStatus returns the status of a call whose session ended.
+func endStatus(s *Session) error {
+	reason, message := s.EndReason()
+	if reason == EndNormal {
+		return nil
+	}
+	return status.Error(grpcCodes[reason], message)
+}
+
+func (speechServer) Recognize(stream flapipb.Speech_RecognizeServer) error {
+	s, release, err := startSession(stream.Context(), "")
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer s.Close()
+
+	go func() {
+		for {
+			chunk, err := stream.Recv()
+			if err != nil {
+				//io.EOF when the client closed its side, or the call was cancelled
+				s.CloseInput()
+				return
+			}
+			if err = s.Write(chunk.Data); err != nil {
+				s.End(EndError, err.Error())
+				return
+			}
+		}
+	}()
+
+	//only this goroutine sends on the stream
+	for {
+		select {
+		case e := <-s.Events():
+			if err = sendEvent(stream, e); err != nil {
+				s.cancel()
+				return err
+			}
+		case <-s.Done():
+			for _, e := range s.FlushEvents() {
+				if err = sendEvent(stream, e); err != nil {
+					return err
+				}
+			}
+			return endStatus(s)
+		}
+	}
+}
+
+func sendEvent(stream flapipb.Speech_RecognizeServer, e EventPayload) error {
+	if pe := toProtoEvent(e); pe != nil {
+		return stream.Send(pe)
+	}
+	return nil
+}
+
+// toProtoEvent converts an event of the websocket protocol.
+func toProtoEvent(e EventPayload) *flapipb.RecognitionEvent {
+	pe := &flapipb.RecognitionEvent{Key: e.Key}
+	switch e.Event {
+	case EStatusChanged:
+		ready, _ := e.Result.(bool)
+		pe.Event = &flapipb.RecognitionEvent_Status{Status: &flapipb.StatusChanged{Ready: ready, Message: e.Message}}
+	case ESpeech:
+		speech := e.Result.(Speech)
+		pe.Event = &flapipb.RecognitionEvent_Speech{Speech: &flapipb.SpeechSegment{
+			Segment: uint32(speech.Segment),
+			Start:   speech.Start,
+			End:     speech.End,
+		}}
+	case EPrediction:
+		pred := e.Result.(recognizer.Prediction)
+		pe.Event = &flapipb.RecognitionEvent_Prediction{Prediction: &flapipb.Prediction{
+			Segment: uint32(pred.Segment),
+			Text:    pred.Text,
+		}}
+	case ERevision:
+		rev := e.Result.(Revision)
+		segments := make([]uint32, len(rev.Segments))
+		for i, index := range rev.Segments {
+			segments[i] = uint32(index)
+		}
+		pe.Event = &flapipb.RecognitionEvent_Revision{Revision: &flapipb.Revision{Segments: segments, Text: rev.Text}}
+	case EOverrun:
+		overrun := e.Result.(Overrun)
+		pe.Event = &flapipb.RecognitionEvent_Overrun{Overrun: &flapipb.Overrun{
+			Bytes:   int64(overrun.Bytes),
+			Policy:  string(overrun.Policy),
+			Seconds: overrun.Seconds,
+		}}
+	case EError:
+		pe.Event = &flapipb.RecognitionEvent_Error{Error: &flapipb.Error{Code: e.Code, Message: e.Message}}
+	default:
+		return nil
+	}
+	return pe
+}
+
+func (speechServer) RecognizeFile(ctx context.Context, req *flapipb.RecognizeFileRequest) (*flapipb.RecognizeFileResponse, error) {
+	select {
+	case <-asrReady:
+	default:
+		return nil, status.Error(codes.Unavailable, "ASR still warming up")
+	}
+	//the whole file is at hand: block instead of dropping audio
+	s, release, err := startSession(ctx, audio.Block)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer s.Close()
+
+	transcript, err := collectTranscript(s, bytes.NewReader(req.Audio), nil)
+	if err != nil {
+		return nil, endStatus(s)
+	}
+	return transcript.Proto(), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+type healthStatus struct {
+	Status     string `json:"status"`
+	Running    bool   `json:"asr_running"`
+	Ready      bool   `json:"asr_ready"`
+	QueueDepth int    `json:"asr_queue_depth"`
+	Restarts   int    `json:"asr_restarts"`
+	Draining   bool   `json:"draining"`
+}
+
+func currentHealth() (h healthStatus) {
+	select {
+	case <-asrReady:
+		h.Ready = atomic.LoadInt32(&rewarming) == 0
+	default:
+	}
+	h.Draining = isDraining()
+	if asr != nil {
+		state := asr.State()
+		h.Running = asr.Ready()
+		h.QueueDepth = state.QueueDepth
+		h.Restarts = state.Restarts
+	}
+	return
+}
+
+func writeHealth(w http.ResponseWriter, h healthStatus, ok bool, reason string) {
+	h.Status = "ok"
+	code := http.StatusOK
+	if !ok {
+		h.Status, code = reason, http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, h)
+}
+
+// handleHealthz reports whether the service and its ASR process are alive.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	h := currentHealth()
+	writeHealth(w, h, h.Running, "asr process not running")
+}
+
+// handleReadyz reports whether the service can take new sessions: warmup is
+// complete, the ASR process is up, and its queue isn't saturated.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	h := currentHealth()
+	switch {
+	case h.Draining:
+		writeHealth(w, h, false, "shutting down")
+	case !h.Ready:
+		writeHealth(w, h, false, "warming up")
+	case !h.Running:
+		writeHealth(w, h, false, "asr process restarting")
+	case Config().Health.MaxQueueDepth > 0 && h.QueueDepth >= Config().Health.MaxQueueDepth:
+		writeHealth(w, h, false, "asr queue saturated")
+	default:
+		writeHealth(w, h, true, "")
+	}
+}
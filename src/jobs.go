@@ -0,0 +1,602 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cowdude/flapi/src/audio"
+	log "github.com/sirupsen/logrus"
+)
+
+// JobStatus is the state of a transcription job.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobDone      JobStatus = "done"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+func (status JobStatus) finished() bool {
+	return status == JobDone || status == JobFailed || status == JobCancelled
+}
+
+// Job is a transcription job of the jobs API. It is also the content of the
+// job.json file of the job directory.
+type Job struct {
+	ID       string      `json:"id"`
+	Status   JobStatus   `json:"status"`
+	Key      string      `json:"key,omitempty"` //label of the API key that created the job
+	Size     int64       `json:"size"`          //bytes of the uploaded audio file
+	Created  time.Time   `json:"created"`
+	Started  *time.Time  `json:"started,omitempty"`
+	Finished *time.Time  `json:"finished,omitempty"`
+	Progress JobProgress `json:"progress"`
+	Error    string      `json:"error,omitempty"`
+}
+
+type JobProgress struct {
+	Scanned       float64 `json:"scanned"`        //percentage of the audio scanned for speech
+	SegmentsDone  int     `json:"segments_done"`  //segments transcribed
+	SegmentsTotal int     `json:"segments_total"` //segments found so far, final once scanned reaches 100
+}
+
+// Files of a job directory.
+const (
+	jobFile   = "job.json"
+	jobAudio  = "audio"       //uploaded file, removed once the job is finished
+	jobResult = "result.json" //transcript of a done job
+)
+
+// jobStore keeps the jobs in memory, and each job in a directory of
+// jobs.dir, so that queued jobs survive restarts. Jobs that were running
+// when the server stopped are queued again.
+type jobStore struct {
+	dir     string
+	wake    chan struct{} //signaled when a job is queued
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	running map[string]*Session
+}
+
+var jobs *jobStore //nil when the jobs API is disabled
+
+var errEmptyUpload = errors.New("empty audio file")
+
+func newJobID() string {
+	var id [12]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// openJobStore loads the jobs of dir, creating it if needed.
+func openJobStore(dir string, concurrency int) (*jobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	store := &jobStore{
+		dir:     dir,
+		wake:    make(chan struct{}, concurrency),
+		jobs:    make(map[string]*Job),
+		running: make(map[string]*Session),
+	}
+	var requeued int
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), ".upload-") {
+			os.RemoveAll(filepath.Join(dir, entry.Name())) //interrupted upload
+			continue
+		}
+		job := new(Job)
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), jobFile))
+		if err == nil {
+			err = json.Unmarshal(data, job)
+		}
+		if err != nil || job.ID != entry.Name() {
+			log.WithError(err).WithField("dir", entry.Name()).Warn("Skipping invalid job directory")
+			continue
+		}
+		if job.Status == JobRunning {
+			job.requeue()
+			if err = store.save(job); err != nil {
+				return nil, err
+			}
+			requeued++
+		}
+		store.jobs[job.ID] = job
+	}
+	log.WithField("dir", dir).WithField("requeued", requeued).Printf("Loaded %d job(s)", len(store.jobs))
+	return store, nil
+}
+
+func (job *Job) requeue() {
+	job.Status = JobQueued
+	job.Started = nil
+	job.Progress = JobProgress{}
+}
+
+func (store *jobStore) path(id string, name string) string {
+	return filepath.Join(store.dir, id, name)
+}
+
+// save writes the job.json file of a job. The caller holds store.mu, unless
+// the job isn't in the store yet.
+func (store *jobStore) save(job *Job) error {
+	return writeFileAtomic(store.path(job.ID, jobFile), func(w *os.File) error {
+		return json.NewEncoder(w).Encode(job)
+	})
+}
+
+// create stores the audio file of a new job, and queues it.
+func (store *jobStore) create(label string, body io.Reader) (Job, error) {
+	tmp, err := os.MkdirTemp(store.dir, ".upload-")
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{
+		ID:      newJobID(),
+		Status:  JobQueued,
+		Key:     label,
+		Created: time.Now().UTC(),
+	}
+	err = writeFileAtomic(filepath.Join(tmp, jobAudio), func(w *os.File) (err error) {
+		job.Size, err = io.Copy(w, body)
+		return
+	})
+	if err == nil && job.Size == 0 {
+		err = errEmptyUpload
+	}
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(tmp, jobFile), func(w *os.File) error {
+			return json.NewEncoder(w).Encode(job)
+		})
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0755)
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(store.dir, job.ID))
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		return Job{}, err
+	}
+
+	store.mu.Lock()
+	store.jobs[job.ID] = job
+	store.mu.Unlock()
+	select {
+	case store.wake <- struct{}{}:
+	default: //enough workers are awake already
+	}
+	return *job, nil
+}
+
+// get returns a job of an API key.
+func (store *jobStore) get(label, id string) (job Job, ok bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if j, found := store.jobs[id]; found && j.Key == label {
+		return *j, true
+	}
+	return
+}
+
+// list returns the jobs of an API key, oldest first.
+func (store *jobStore) list(label string) []Job {
+	store.mu.Lock()
+	list := make([]Job, 0, len(store.jobs))
+	for _, job := range store.jobs {
+		if job.Key == label {
+			list = append(list, *job)
+		}
+	}
+	store.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.Before(list[j].Created)
+	})
+	return list
+}
+
+// cancel cancels a queued or running job, or deletes a finished one.
+func (store *jobStore) cancel(label, id string) (job Job, deleted, ok bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	j, found := store.jobs[id]
+	if !found || j.Key != label {
+		return
+	}
+	ok = true
+	s, running := store.running[id]
+	switch {
+	case j.Status.finished() && !running:
+		delete(store.jobs, id)
+		if err := os.RemoveAll(filepath.Join(store.dir, id)); err != nil {
+			log.WithError(err).WithField("job", id).Error("Failed to delete job")
+		}
+		return *j, true, true
+	case j.Status == JobQueued:
+		os.Remove(store.path(id, jobAudio))
+		metricJobs.WithLabelValues(string(JobCancelled)).Inc()
+	case running && j.Status == JobRunning:
+		s.End(EndKicked, "job cancelled") //the worker finishes the job
+	}
+	if !j.Status.finished() {
+		now := time.Now().UTC()
+		j.Status, j.Finished = JobCancelled, &now
+		if err := store.save(j); err != nil {
+			log.WithError(err).WithField("job", id).Error("Failed to save job")
+		}
+	}
+	return *j, false, true
+}
+
+// next marks the oldest queued job as running, and returns it.
+func (store *jobStore) next() (job Job, ok bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var oldest *Job
+	for _, j := range store.jobs {
+		if j.Status == JobQueued && (oldest == nil || j.Created.Before(oldest.Created)) {
+			oldest = j
+		}
+	}
+	if oldest == nil {
+		return
+	}
+	now := time.Now().UTC()
+	oldest.Status, oldest.Started = JobRunning, &now
+	oldest.Progress = JobProgress{}
+	if err := store.save(oldest); err != nil {
+		log.WithError(err).WithField("job", oldest.ID).Error("Failed to save job")
+	}
+	return *oldest, true
+}
+
+// jobReader counts the bytes of the audio file fed to the session.
+type jobReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *jobReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return
+}
+
+// run transcribes a job through a background session.
+func (store *jobStore) run(job Job) {
+	jlog := log.WithField("job", job.ID)
+	jlog.Println("Running job")
+	err := func() error {
+		f, err := os.Open(store.path(job.ID, jobAudio))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		//the whole file is at hand: block instead of dropping audio
+		s := NewSession(context.Background(), SessionOptions{
+			Transport:  "job",
+			Remote:     job.ID,
+			KeyLabel:   job.Key,
+			Overflow:   audio.Block,
+			Background: true,
+		})
+		registerSession(s)
+		defer unregisterSession(s)
+		defer s.Close()
+		store.mu.Lock()
+		j, ok := store.jobs[job.ID] //cancelled, then deleted before it started
+		cancelled := !ok || j.Status == JobCancelled
+		store.running[job.ID] = s
+		store.mu.Unlock()
+		if cancelled {
+			return errors.New("job cancelled")
+		}
+		if isDraining() { //registered after the shutdown drained the sessions
+			return errors.New("server shutting down")
+		}
+
+		in := &jobReader{Reader: f}
+		progress := func(e *EventPayload) {
+			scanned := atomic.LoadInt64(&in.n) - int64(s.Audio.In.Buffered())
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			p := &store.jobs[job.ID].Progress
+			p.Scanned = math.Max(0, math.Floor(1000*float64(scanned)/float64(job.Size))/10)
+			if e == nil {
+				return
+			}
+			switch e.Event {
+			case ESpeech:
+				p.SegmentsTotal++
+			case EPrediction:
+				p.SegmentsDone++
+			}
+		}
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() { //keep the progress moving through long silences
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					progress(nil)
+				case <-stop:
+					return
+				}
+			}
+		}()
+
+		transcript, err := collectTranscript(s, in, func(e EventPayload) { progress(&e) })
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(store.path(job.ID, jobResult), func(w *os.File) error {
+			return transcript.WriteJSON(w)
+		})
+	}()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.running, job.ID)
+	j, found := store.jobs[job.ID]
+	if !found { //cancelled, then deleted before it started
+		return
+	}
+	var serr *SessionError
+	switch {
+	case j.Status == JobCancelled:
+		jlog.Println("Job cancelled")
+	case err != nil && (errors.As(err, &serr) && serr.Reason == EndShutdown || isDraining()):
+		jlog.Warn("Job interrupted by shutdown, queued again")
+		j.requeue()
+		if err = store.save(j); err != nil {
+			jlog.WithError(err).Error("Failed to save job")
+		}
+		return
+	case err != nil:
+		jlog.WithError(err).Error("Job failed")
+		j.Status, j.Error = JobFailed, err.Error()
+	default:
+		j.Status = JobDone
+		j.Progress.Scanned = 100
+		j.Progress.SegmentsTotal = j.Progress.SegmentsDone
+		jlog.WithField("duration", time.Since(*j.Started).Round(time.Millisecond)).Println("Job done")
+	}
+	if j.Finished == nil {
+		now := time.Now().UTC()
+		j.Finished = &now
+	}
+	metricJobs.WithLabelValues(string(j.Status)).Inc()
+	if err = store.save(j); err != nil {
+		jlog.WithError(err).Error("Failed to save job")
+	}
+	os.Remove(store.path(job.ID, jobAudio))
+}
+
+// result reads the transcript of a done job.
+func (store *jobStore) result(id string) (*Transcript, error) {
+	data, err := os.ReadFile(store.path(id, jobResult))
+	if err != nil {
+		return nil, err
+	}
+	t := new(Transcript)
+	return t, json.Unmarshal(data, t)
+}
+
+// expire deletes the jobs finished for longer than jobs.retention.
+func (store *jobStore) expire() {
+	retention := Config().Jobs.Retention
+	if retention == 0 {
+		return
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for id, job := range store.jobs {
+		if job.Finished == nil || time.Since(*job.Finished) < retention || store.running[id] != nil {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(store.dir, id)); err != nil {
+			log.WithError(err).WithField("job", id).Error("Failed to delete expired job")
+			continue
+		}
+		delete(store.jobs, id)
+	}
+}
+
+// serve runs the queued jobs, concurrency at a time, until the server shuts down.
+func (store *jobStore) serve(concurrency int) {
+	select {
+	case <-asrReady:
+	case <-drainingC:
+		return
+	}
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			for !isDraining() {
+				if job, ok := store.next(); ok {
+					store.run(job)
+					continue
+				}
+				select {
+				case <-store.wake:
+				case <-drainingC:
+				}
+			}
+		}()
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		store.expire()
+		select {
+		case <-ticker.C:
+		case <-drainingC:
+			return
+		}
+	}
+}
+
+const jobsPrefix = "/v1/jobs"
+
+// handleJobs serves the jobs API. Jobs are only visible to the API key that
+// created them.
+//
+//	POST   /v1/jobs              create a job, the request body being the audio file
+//	GET    /v1/jobs              jobs of the API key
+//	GET    /v1/jobs/{id}         status and progress of a job
+//	GET    /v1/jobs/{id}/result  transcript of a done job (?format=json, txt, srt or vtt)
+//	DELETE /v1/jobs/{id}         cancel a queued or running job, or delete a finished one
+func handleJobs(w http.ResponseWriter, r *http.Request) {
+	if jobs == nil {
+		writeError(w, http.StatusNotFound, "jobs API disabled")
+		return
+	}
+	label, err := authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	var route []string
+	if path := strings.Trim(strings.TrimPrefix(r.URL.Path, jobsPrefix), "/"); path != "" {
+		route = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(route) == 0:
+		switch r.Method {
+		case http.MethodPost:
+			createJob(w, r, label)
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, jobs.list(label))
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		}
+
+	case len(route) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			job, ok := jobs.get(label, route[0])
+			if !ok {
+				writeError(w, http.StatusNotFound, "no such job")
+				return
+			}
+			writeJSON(w, http.StatusOK, job)
+		case http.MethodDelete:
+			job, deleted, ok := jobs.cancel(label, route[0])
+			if !ok {
+				writeError(w, http.StatusNotFound, "no such job")
+				return
+			}
+			if deleted {
+				log.WithField("job", job.ID).Println("Job deleted")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			writeJSON(w, http.StatusOK, job)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+
+	case len(route) == 2 && route[1] == "result":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		getJobResult(w, r, label, route[0])
+
+	default:
+		writeError(w, http.StatusNotFound, "unknown jobs endpoint")
+	}
+}
+
+func createJob(w http.ResponseWriter, r *http.Request, label string) {
+	if isDraining() {
+		writeCodedError(w, http.StatusServiceUnavailable, ErrCodeShuttingDown, "server shutting down")
+		return
+	}
+	max := Config().Jobs.MaxUploadSize
+	if r.ContentLength > max {
+		writeCodedError(w, http.StatusRequestEntityTooLarge, ErrCodeInvalidAudio, "audio file too large")
+		return
+	}
+	job, err := jobs.create(label, limitBody(r.Body, max))
+	switch {
+	case err == errEmptyUpload:
+		writeCodedError(w, http.StatusBadRequest, ErrCodeInvalidAudio, err.Error())
+		return
+	case errors.Is(err, errBodyTooLarge):
+		writeCodedError(w, http.StatusRequestEntityTooLarge, ErrCodeInvalidAudio, "audio file too large")
+		return
+	case err != nil:
+		log.WithError(err).Error("Failed to store job")
+		writeError(w, http.StatusInternalServerError, "failed to store the audio file")
+		return
+	}
+	log.WithField("job", job.ID).WithField("key", label).WithField("size", job.Size).Println("Job queued")
+	w.Header().Set("Location", jobsPrefix+"/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func getJobResult(w http.ResponseWriter, r *http.Request, label, id string) {
+	job, ok := jobs.get(label, id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such job")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	write, ok := transcriptWriters[format]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "unknown format, expected json, txt, srt or vtt")
+		return
+	}
+	if job.Status != JobDone {
+		writeCodedError(w, http.StatusConflict, ErrCodeJobNotDone, "job is "+string(job.Status))
+		return
+	}
+	transcript, err := jobs.result(id)
+	if err != nil {
+		log.WithError(err).WithField("job", id).Error("Failed to read job result")
+		writeError(w, http.StatusInternalServerError, "failed to read the result")
+		return
+	}
+	contentTypes := map[string]string{
+		"json": "application/json",
+		"txt":  "text/plain; charset=utf-8",
+		"srt":  "application/x-subrip; charset=utf-8",
+		"vtt":  "text/vtt; charset=utf-8",
+	}
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Cache-Control", "no-store")
+	write(&transcript.Transcript, w)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withJobStore enables the jobs API on a store in a temporary directory. Its
+// jobs are run by the tests, with runNext.
+func withJobStore(t *testing.T) *jobStore {
+	store, err := openJobStore(t.TempDir(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs = store
+	t.Cleanup(func() { jobs = nil })
+	return store
+}
+
+// runNext runs the oldest queued job, like a worker of serve.
+func runNext(t *testing.T, store *jobStore) {
+	job, ok := store.next()
+	if !ok {
+		t.Fatal("no queued job")
+	}
+	store.run(job)
+}
+
+// jobRequest sends a request to the jobs API, and decodes its JSON response into v.
+func jobRequest(t *testing.T, method, path string, body []byte, v interface{}) *http.Response {
+	w := httptest.NewRecorder()
+	handleJobs(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+	res := w.Result()
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			t.Fatalf("%v %v: %v", method, path, err)
+		}
+	}
+	return res
+}
+
+func TestJobLifecycle(t *testing.T) {
+	store := withJobStore(t)
+	var job Job
+	res := jobRequest(t, http.MethodPost, "/v1/jobs", testAudio(time.Second, time.Second, time.Second), &job)
+	if res.StatusCode != http.StatusAccepted || job.Status != JobQueued || res.Header.Get("Location") != "/v1/jobs/"+job.ID {
+		t.Fatalf("create: %v %+v, location %q", res.Status, job, res.Header.Get("Location"))
+	}
+	var apiErr apiError
+	if res = jobRequest(t, http.MethodGet, "/v1/jobs/"+job.ID+"/result", nil, &apiErr); res.StatusCode != http.StatusConflict || apiErr.Code != ErrCodeJobNotDone {
+		t.Errorf("result of a queued job: %v %+v", res.Status, apiErr)
+	}
+
+	runNext(t, store)
+	if jobRequest(t, http.MethodGet, "/v1/jobs/"+job.ID, nil, &job); job.Status != JobDone || job.Finished == nil {
+		t.Fatalf("job not done: %+v", job)
+	}
+	if p := job.Progress; p.Scanned != 100 || p.SegmentsDone != 2 || p.SegmentsTotal != 2 {
+		t.Errorf("progress of a done job: %+v", p)
+	}
+	var list []Job
+	if jobRequest(t, http.MethodGet, "/v1/jobs", nil, &list); len(list) != 1 || list[0].ID != job.ID {
+		t.Errorf("job list: %+v", list)
+	}
+
+	var transcript Transcript
+	jobRequest(t, http.MethodGet, "/v1/jobs/"+job.ID+"/result", nil, &transcript)
+	if len(transcript.Segments) != 2 || transcript.Text() != testPrediction+" "+testPrediction {
+		t.Errorf("json result: %+v", transcript)
+	}
+	res = jobRequest(t, http.MethodGet, "/v1/jobs/"+job.ID+"/result?format=txt", nil, nil)
+	if text, _ := io.ReadAll(res.Body); string(text) != strings.Repeat(testPrediction+"\n", 2) {
+		t.Errorf("txt result: %q", text)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	store := withJobStore(t)
+	var job Job
+	jobRequest(t, http.MethodPost, "/v1/jobs", testAudio(time.Second), &job)
+
+	if res := jobRequest(t, http.MethodDelete, "/v1/jobs/"+job.ID, nil, &job); res.StatusCode != http.StatusOK || job.Status != JobCancelled {
+		t.Fatalf("cancel: %v %+v", res.Status, job)
+	}
+	if _, ok := store.next(); ok {
+		t.Error("cancelled job picked up by a worker")
+	}
+	if res := jobRequest(t, http.MethodDelete, "/v1/jobs/"+job.ID, nil, nil); res.StatusCode != http.StatusNoContent {
+		t.Errorf("delete of a cancelled job: %v", res.Status)
+	}
+	if res := jobRequest(t, http.MethodGet, "/v1/jobs/"+job.ID, nil, nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("deleted job: %v", res.Status)
+	}
+}
+
+// Jobs running when the server stopped are queued again on the next start.
+func TestJobRequeuedOnReopen(t *testing.T) {
+	store := withJobStore(t)
+	var job Job
+	jobRequest(t, http.MethodPost, "/v1/jobs", testAudio(time.Second), &job)
+	if _, ok := store.next(); !ok { //running, then the server stops
+		t.Fatal("no queued job")
+	}
+
+	reopened, err := openJobStore(store.dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs = reopened
+	if job, _ = reopened.get("", job.ID); job.Status != JobQueued || job.Started != nil {
+		t.Fatalf("job not queued again: %+v", job)
+	}
+	runNext(t, reopened)
+	if job, _ = reopened.get("", job.ID); job.Status != JobDone {
+		t.Errorf("requeued job not done: %+v", job)
+	}
+}
@@ -1,49 +1,117 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"path"
 	"runtime"
 	"runtime/pprof"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/cowdude/flapi/src/audio"
+	"github.com/cowdude/flapi/src/recognizer"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 )
 
-var asr *ASRRunner
+var asr recognizer.Recognizer
 var verbose = flag.Bool("v", false, "enable debug logging")
 var asrReady = make(chan struct{})
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 var profileDuration = flag.Duration("profile", time.Minute*3, "profiling duration")
+var checkConfig = flag.Bool("check-config", false, "validate the config, print the effective config and exit")
 
-//go:embed index.html main.js
+//go:embed index.html main.js flapi-v2.schema.json
 var www embed.FS
 
 func warmup() {
-	defer close(asrReady)
-	defer DispatchEvent(EventPayload{
+	if err := runWarmup(); err != nil {
+		log.Fatal(err)
+	}
+	//closed first: sessions registered meanwhile see it, the others get the event
+	close(asrReady)
+	DispatchEvent(EventPayload{
 		Event:   EStatusChanged,
 		Result:  true,
 		Message: "ASR is ready",
 	})
+}
 
-	if Config.Warmup == nil {
-		return
+// newRecognizer returns the engine selected by recognizer.engine.
+func newRecognizer(cfg *Configuration) recognizer.Recognizer {
+	switch cfg.Recognizer.Engine {
+	case "remote":
+		return recognizer.NewRemote(func() recognizer.RemoteConfig { return Config().Recognizer.Remote })
+	case "stub":
+		return recognizer.NewStub(func() recognizer.StubConfig { return Config().Recognizer.Stub })
+	default:
+		return recognizer.NewFlashlight(func() recognizer.FlashlightConfig { return Config().Flashlight })
 	}
-	for i := 0; i < Config.Warmup.Repeat; i++ {
-		log.Printf("Warming up (%d/%d) ...", i+1, Config.Warmup.Repeat)
-		if pred, err := asr.Predict(Config.Warmup.Audio); err != nil {
-			log.Error("warmup prediction failed")
-			log.Panic(err)
-		} else if strings.ToLower(pred.Text) != strings.ToLower(Config.Warmup.GroundTruth) {
-			log.Fatalf("warmup prediction differs from ground truth: %+v", pred)
+}
+
+// runWarmup runs the smoke-test of the warmup section, if any.
+func runWarmup() error {
+	opts := Config().Warmup
+	if opts == nil {
+		return nil
+	}
+	f, err := os.Open(opts.Audio)
+	if err != nil {
+		return err
+	}
+	format, data, err := audio.ReadWAV(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read warmup audio: %w", err)
+	}
+	seg := recognizer.Segment{Name: "warmup", Format: format, Frames: data}
+	for i := 0; i < opts.Repeat; i++ {
+		log.Printf("Warming up (%d/%d) ...", i+1, opts.Repeat)
+		if pred, err := asr.Recognize(context.Background(), seg, recognizer.Options{}); err != nil {
+			return fmt.Errorf("warmup prediction failed: %w", err)
+		} else if strings.ToLower(pred.Text) != strings.ToLower(opts.GroundTruth) {
+			return fmt.Errorf("warmup prediction differs from ground truth: %+v", pred)
 		}
 	}
 	log.Println("Warmup complete")
+	return nil
+}
+
+// rewarming is 1 while a warmup requested through the admin API runs, and 2 if it failed.
+var rewarming int32
+
+var errWarmupRunning = errors.New("warmup already running")
+
+// rewarmup runs the warmup again in the background, e.g. after a runner restart.
+// The service reports itself as not ready until it completes; a failed warmup
+// is logged, and leaves the service not ready until the next successful one.
+func rewarmup() error {
+	select {
+	case <-asrReady:
+	default:
+		return errWarmupRunning
+	}
+	if !atomic.CompareAndSwapInt32(&rewarming, 0, 1) && !atomic.CompareAndSwapInt32(&rewarming, 2, 1) {
+		return errWarmupRunning
+	}
+	go func() {
+		if err := runWarmup(); err != nil {
+			log.WithError(err).Error("Warmup failed")
+			atomic.StoreInt32(&rewarming, 2)
+			return
+		}
+		atomic.StoreInt32(&rewarming, 0)
+	}()
+	return nil
 }
 
 var logLabels = make(map[string]string)
@@ -60,14 +128,52 @@ func callerPrettifier(f *runtime.Frame) (function string, file string) {
 	return
 }
 
-func init() {
+// jsonCallerPrettifier reports the caller as a "file:line" field, without the function.
+func jsonCallerPrettifier(f *runtime.Frame) (function string, file string) {
+	return "", fmt.Sprintf("%s:%d", path.Base(f.File), f.Line)
+}
+
+func setupLogging(cfg *Configuration) error {
+	switch cfg.Log.Format {
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{
+			CallerPrettyfier: jsonCallerPrettifier,
+		})
+	case "", "text":
+		log.SetFormatter(&log.TextFormatter{
+			PadLevelText:     true,
+			CallerPrettyfier: callerPrettifier,
+		})
+	default:
+		return fmt.Errorf("unknown log format '%v'", cfg.Log.Format)
+	}
+	return nil
+}
+
+// setup parses the command line, and loads the config file. It is not an init
+// function, so that tests can run without a config file.
+func setup() {
 	flag.Parse()
-	LoadConfig()
+	cfg, err := LoadConfig()
+	if *checkConfig {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err = printConfig(cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = setupLogging(cfg); err != nil {
+		log.Fatal(err)
+	}
+	currentConfig.Store(cfg)
 
-	log.SetFormatter(&log.TextFormatter{
-		PadLevelText:     true,
-		CallerPrettyfier: callerPrettifier,
-	})
 	log.SetReportCaller(true)
 	if *verbose {
 		log.SetLevel(log.DebugLevel)
@@ -75,10 +181,11 @@ func init() {
 		log.SetLevel(log.InfoLevel)
 	}
 	log.Printf("Log level set to %v", log.GetLevel())
-	log.Printf("Config: %+v", Config)
+	log.Printf("Loaded %d API key(s)", len(cfg.keyring))
 }
 
 func main() {
+	setup()
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
 		if err != nil {
@@ -96,16 +203,79 @@ func main() {
 		}()
 	}
 
-	asr = NewRunner()
-	defer asr.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
+	asr = newRecognizer(Config())
 	go func() {
-		log.Panic(asr.Run())
+		err := asr.Run()
+		if ctx.Err() == nil {
+			log.Panic(err)
+		}
+		log.WithError(err).Println("ASR process exited")
 	}()
 	go warmup()
+	if dir := Config().Jobs.Dir; dir != "" {
+		var err error
+		if jobs, err = openJobStore(dir, Config().Jobs.Concurrency); err != nil {
+			log.Fatal("Failed to open the job store: ", err)
+		}
+		go jobs.serve(Config().Jobs.Concurrency)
+	}
 
 	http.HandleFunc("/v1/ws", handleWS)
+	http.HandleFunc("/v2/ws", handleWSv2)
+	http.HandleFunc("/v1/recognize", handleRecognize)
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
+	http.HandleFunc("/v1/jobs", handleJobs)
+	http.HandleFunc("/v1/jobs/", handleJobs)
+	http.HandleFunc("/admin/v1/", handleAdmin)
 	http.Handle("/", http.FileServer(http.FS(www)))
-	log.Printf("http listening on %v", Config.HTTP.Listen)
-	log.Fatal(http.ListenAndServe(Config.HTTP.Listen, nil))
+	cfg := Config()
+	server := &http.Server{Addr: cfg.HTTP.Listen}
+	if cfg.HTTP.TLS.Cert != "" {
+		var err error
+		if server.TLSConfig, err = newTLSConfig("h2", "http/1.1"); err != nil {
+			log.Fatal("Failed to load TLS config: ", err)
+		}
+	}
+
+	go func() {
+		var err error
+		if server.TLSConfig == nil {
+			log.Printf("http listening on %v", cfg.HTTP.Listen)
+			err = server.ListenAndServe()
+		} else {
+			log.WithField("mtls", cfg.HTTP.TLS.ClientCA != "").Printf("https listening on %v", cfg.HTTP.Listen)
+			err = server.ListenAndServeTLS("", "")
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	if cfg.GRPC.Listen != "" {
+		var err error
+		if grpcServer, err = newGRPCServer(cfg); err != nil {
+			log.Fatal("Failed to create the gRPC server: ", err)
+		}
+		go serveGRPC(grpcServer, cfg.GRPC.Listen)
+	}
+
+	go watchFolders(ctx)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Println("SIGHUP received, reloading config")
+			ReloadConfig()
+		}
+	}()
+
+	<-ctx.Done()
+	stop() //a second signal kills the process
+	shutdown(server)
 }
@@ -54,7 +54,11 @@ function enableRecorder (on) {
 
 function manageWebsocket () {
   if (ws) ws.close()
-  ws = new WebSocket('ws://' + document.location.host + '/v1/ws')
+  // forward the API key of the demo page URL (?token=...), if any
+  let token = new URLSearchParams(document.location.search).get('token')
+  let query = token ? '?token=' + encodeURIComponent(token) : ''
+  let scheme = document.location.protocol == 'https:' ? 'wss://' : 'ws://'
+  ws = new WebSocket(scheme + document.location.host + '/v1/ws' + query)
   ws.onopen = e => {
     button.setAttribute('disabled', true)
     comment('websocket open')
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The tests run the server on cmd/fake-flashlight, which predicts
+// testPrediction for every segment. When ffmpeg isn't installed, a stand-in
+// copies its input to its output: the test audio is already in the format the
+// transcoder outputs.
+const testPrediction = "hello world"
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "flapi-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := 1
+	if err = setupTestServer(dir); err != nil {
+		fmt.Fprintln(os.Stderr, "test setup failed:", err)
+	} else {
+		code = m.Run()
+		asr.Close()
+	}
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func setupTestServer(dir string) error {
+	log.SetLevel(log.WarnLevel)
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		if err = os.WriteFile(filepath.Join(dir, "ffmpeg"), []byte("#!/bin/sh\nexec cat\n"), 0755); err != nil {
+			return err
+		}
+		os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	}
+	fake := filepath.Join(dir, "fake-flashlight")
+	build := exec.Command("go", "build", "-o", fake, "github.com/cowdude/flapi/src/cmd/fake-flashlight")
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	if err := build.Run(); err != nil {
+		return fmt.Errorf("failed to build fake-flashlight: %w", err)
+	}
+	hello := filepath.Join(dir, "hello.wav")
+	if err := os.WriteFile(hello, testAudio(time.Second), 0644); err != nil {
+		return err
+	}
+
+	cfg := defaultConfig()
+	cfg.Flashlight.Executable = fake
+	cfg.Flashlight.AccousticModel, cfg.Flashlight.LanguageModel = "", ""
+	cfg.Flashlight.Tokens, cfg.Flashlight.Lexicon = "", ""
+	cfg.Flashlight.ExtraArgs = []string{"--fake_text=" + testPrediction}
+	cfg.Warmup = &struct {
+		Audio       string
+		GroundTruth string `yaml:"ground_truth"`
+		Repeat      int
+	}{hello, testPrediction, 1}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	currentConfig.Store(cfg)
+
+	asr = newRecognizer(cfg)
+	go asr.Run()
+	if err := runWarmup(); err != nil {
+		asr.Close()
+		return err
+	}
+	close(asrReady)
+	return nil
+}
+
+// testAudio returns a 16kHz mono WAV file of alternating spans of speech (a
+// loud tone, for the activity detection) and silence, starting with speech.
+func testAudio(spans ...time.Duration) []byte {
+	const rate = 16000
+	var samples []int16
+	for i, span := range spans {
+		n := int(span.Seconds() * rate)
+		for j := 0; j < n; j++ {
+			var sample int16
+			if i%2 == 0 {
+				sample = int16(16000 * math.Sin(2*math.Pi*440*float64(j)/rate))
+			}
+			samples = append(samples, sample)
+		}
+	}
+	var buf bytes.Buffer
+	size := uint32(2 * len(samples))
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, 36+size)
+	buf.WriteString("WAVEfmt ")
+	for _, field := range []interface{}{
+		uint32(16), uint16(1), uint16(1), uint32(rate), uint32(2 * rate), uint16(2), uint16(16), //PCM, mono, 16 bits
+	} {
+		binary.Write(&buf, binary.LittleEndian, field)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, size)
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
+// withConfig applies changes to a copy of the current configuration, until
+// the end of the test.
+func withConfig(t *testing.T, change func(cfg *Configuration)) {
+	prev := Config()
+	next := *prev
+	change(&next)
+	currentConfig.Store(&next)
+	t.Cleanup(func() { currentConfig.Store(prev) })
+}
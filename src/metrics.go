@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/cowdude/flapi/src/audio"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics are exposed in the Prometheus text format on /metrics.
+// The recognizer package defines the flapi_asr_* metrics of the decoding itself.
+var (
+	metricInputReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "flapi_input_received_bytes_total",
+		Help: "Audio bytes received from clients, before transcoding.",
+	})
+	metricInputOverrun = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "flapi_input_overrun_bytes_total",
+		Help: "Audio bytes lost to input buffer overflows.",
+	})
+	metricAudioTranscoded = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "flapi_audio_transcoded_seconds_total",
+		Help: "Duration of the audio transcoded to PCM.",
+	})
+	metricSegments = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "flapi_segments_total",
+		Help: "Audio segments transcribed.",
+	})
+	metricSegmentsEmpty = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "flapi_segments_empty_total",
+		Help: "Audio segments transcribed to an empty prediction.",
+	})
+	metricASRRealTimeFactor = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "flapi_asr_real_time_factor",
+		Help:    "Ratio of the decoding time to the duration of the decoded audio.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 10),
+	})
+	metricWatchFiles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flapi_watch_files_total",
+		Help: "Files of the watch folders processed, by result: done or error.",
+	}, []string{"result"})
+	metricJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "flapi_jobs_total",
+		Help: "Transcription jobs finished, by status: done, failed or cancelled.",
+	}, []string{"status"})
+)
+
+func init() {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "flapi_clients_active",
+		Help: "Active sessions: websocket and gRPC clients, and watched files.",
+	}, func() float64 {
+		sessionsEx.Lock()
+		defer sessionsEx.Unlock()
+		return float64(len(sessions))
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "flapi_jobs_queued",
+		Help: "Transcription jobs waiting to run.",
+	}, func() float64 {
+		if jobs == nil {
+			return 0
+		}
+		var queued int
+		jobs.mu.Lock()
+		defer jobs.mu.Unlock()
+		for _, job := range jobs.jobs {
+			if job.Status == JobQueued {
+				queued++
+			}
+		}
+		return float64(queued)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "flapi_input_buffered_bytes",
+		Help: "Audio bytes waiting in the client input buffers.",
+	}, func() float64 {
+		var buffered int
+		sessionsEx.Lock()
+		defer sessionsEx.Unlock()
+		for _, client := range sessions {
+			buffered += client.Audio.In.Buffered()
+		}
+		return float64(buffered)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "flapi_input_buffer_fill_max",
+		Help: "Fill ratio of the fullest client input buffer.",
+	}, func() (max float64) {
+		sessionsEx.Lock()
+		defer sessionsEx.Unlock()
+		for _, client := range sessions {
+			if fill := float64(client.Audio.In.Buffered()) / float64(client.Audio.In.Cap()); fill > max {
+				max = fill
+			}
+		}
+		return
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "flapi_ffmpeg_processes",
+		Help: "Running ffmpeg transcoding processes.",
+	}, func() float64 {
+		return float64(audio.RunningProcesses())
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "flapi_asr_queue_depth",
+		Help: "Segments waiting for, or being decoded by the ASR process.",
+	}, func() float64 {
+		if asr == nil {
+			return 0
+		}
+		return float64(asr.State().QueueDepth)
+	})
+}
+
+// countingReader accounts for the PCM audio read from the transcoder.
+type countingReader struct {
+	audio.AudioReader
+	bytesPerSecond float64
+	n              *int64 //bytes read
+}
+
+func (r countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.AudioReader.Read(p)
+	metricAudioTranscoded.Add(float64(n) / r.bytesPerSecond)
+	atomic.AddInt64(r.n, int64(n))
+	return
+}
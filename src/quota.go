@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limits bound the usage of each API key label. Zero values disable a limit.
+type Limits struct {
+	MaxSessions        int           `yaml:"max_sessions"`         //Concurrent sessions
+	AudioPerMinute     time.Duration `yaml:"audio_per_minute"`     //Transcribed audio per calendar minute
+	AudioPerDay        time.Duration `yaml:"audio_per_day"`        //Transcribed audio per calendar day (UTC)
+	MaxSessionDuration time.Duration `yaml:"max_session_duration"` //Wall-clock duration of a session
+}
+
+// Error codes sent in error events, and in the errors of the HTTP APIs.
+const (
+	ErrCodeTooManySessions   = "too_many_sessions"
+	ErrCodeAudioQuota        = "audio_quota_exceeded"
+	ErrCodeSessionDuration   = "session_duration_exceeded"
+	ErrCodeASRNotReady       = "asr_not_ready"
+	ErrCodePredictionFailure = "prediction_failed"
+	ErrCodeInvalidAudio      = "invalid_audio"
+	ErrCodeInvalidMessage    = "invalid_message" //v2 websocket: malformed or unknown client message
+	ErrCodeInvalidState      = "invalid_state"   //v2 websocket: message or audio not allowed at this point of the session
+	ErrCodeShuttingDown      = "shutting_down"
+	ErrCodeJobNotDone        = "job_not_done" //jobs API: the result of a job that isn't done
+)
+
+// QuotaError reports a limit hit by a client session.
+type QuotaError struct {
+	Code    string
+	Message string
+}
+
+func (err *QuotaError) Error() string { return err.Message }
+
+type quotaWindow struct {
+	start time.Time
+	used  time.Duration
+}
+
+// charge adds d to the window starting at start, and tells whether the window
+// is still within limit.
+func (w *quotaWindow) charge(start time.Time, d, limit time.Duration) bool {
+	if !w.start.Equal(start) {
+		w.start, w.used = start, 0
+	}
+	w.used += d
+	return limit <= 0 || w.used <= limit
+}
+
+type keyUsage struct {
+	sessions    int
+	minute, day quotaWindow
+}
+
+var (
+	usages   = make(map[string]*keyUsage)
+	usagesEx sync.Mutex
+)
+
+func usageOf(label string) *keyUsage {
+	u, ok := usages[label]
+	if !ok {
+		u = new(keyUsage)
+		usages[label] = u
+	}
+	return u
+}
+
+// acquireSession reserves a session slot for the given key label.
+// Successful calls must be paired with a call to releaseSession.
+func acquireSession(label string) error {
+	limits := limitsFor(label)
+	usagesEx.Lock()
+	defer usagesEx.Unlock()
+	u := usageOf(label)
+	if limits.MaxSessions > 0 && u.sessions >= limits.MaxSessions {
+		return &QuotaError{
+			Code:    ErrCodeTooManySessions,
+			Message: fmt.Sprintf("too many concurrent sessions (max %d)", limits.MaxSessions),
+		}
+	}
+	u.sessions++
+	return nil
+}
+
+func releaseSession(label string) {
+	usagesEx.Lock()
+	usageOf(label).sessions--
+	usagesEx.Unlock()
+}
+
+// chargeAudio accounts for d of transcoded audio sent to the ASR.
+func chargeAudio(label string, d time.Duration) error {
+	limits := limitsFor(label)
+	now := time.Now().UTC()
+	usagesEx.Lock()
+	defer usagesEx.Unlock()
+	u := usageOf(label)
+	if !u.minute.charge(now.Truncate(time.Minute), d, limits.AudioPerMinute) {
+		return &QuotaError{
+			Code:    ErrCodeAudioQuota,
+			Message: fmt.Sprintf("audio quota exceeded (%v per minute)", limits.AudioPerMinute),
+		}
+	}
+	if !u.day.charge(now.Truncate(24*time.Hour), d, limits.AudioPerDay) {
+		return &QuotaError{
+			Code:    ErrCodeAudioQuota,
+			Message: fmt.Sprintf("audio quota exceeded (%v per day)", limits.AudioPerDay),
+		}
+	}
+	return nil
+}
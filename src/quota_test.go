@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cowdude/flapi/src/client"
+)
+
+// quotaSession streams audio with an API key, and returns the code of the
+// error event ending the session, if any.
+func quotaSession(t *testing.T, server *httptest.Server, key string, audio []byte) (code string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := client.Dial(ctx, server.URL, client.Options{APIKey: key, OnEvent: func(e client.Event) {
+		if e, ok := e.(*client.ErrorEvent); ok {
+			code = e.Code
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err = c.WaitReady(ctx); err == nil {
+		err = c.Stream(ctx, bytes.NewReader(audio))
+	}
+	return
+}
+
+// endedByPolicy tells whether err reports a session ended by a limit.
+func endedByPolicy(err error) bool {
+	var end *client.EndError
+	return errors.As(err, &end) && end.Reason == client.ReasonPolicy
+}
+
+func TestQuotaWindow(t *testing.T) {
+	var w quotaWindow
+	minute := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	if !w.charge(minute, 40*time.Second, time.Minute) || w.charge(minute, 30*time.Second, time.Minute) {
+		t.Error("limit of the window not enforced")
+	}
+	if !w.charge(minute.Add(time.Minute), 30*time.Second, time.Minute) || w.used != 30*time.Second {
+		t.Errorf("usage not reset by a new window: %v", w.used)
+	}
+	if !w.charge(minute, time.Hour, 0) {
+		t.Error("zero limit enforced")
+	}
+}
+
+func TestTooManySessions(t *testing.T) {
+	withAuth(t, func(cfg *Configuration) {
+		addKey(cfg, "one-key", "one", &Limits{MaxSessions: 1})
+	})
+	server := httptest.NewServer(http.HandlerFunc(handleWSv2))
+	defer server.Close()
+
+	first := dialTest(t, client.Options{APIKey: "one-key"})
+	code, err := quotaSession(t, server, "one-key", testAudio(time.Second))
+	if code != ErrCodeTooManySessions || !endedByPolicy(err) {
+		t.Errorf("second session: got code %q, %v", code, err)
+	}
+
+	//the slot is released when the session ends
+	first.Close()
+	var last error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if last = acquireSession("one"); last == nil {
+			releaseSession("one")
+			return
+		}
+	}
+	t.Errorf("slot not released: %v", last)
+}
+
+func TestAudioQuotas(t *testing.T) {
+	withAuth(t, func(cfg *Configuration) {
+		addKey(cfg, "minute-key", "minute", &Limits{AudioPerMinute: 1500 * time.Millisecond})
+		addKey(cfg, "day-key", "day", &Limits{AudioPerDay: 1500 * time.Millisecond})
+	})
+	server := httptest.NewServer(http.HandlerFunc(handleWSv2))
+	defer server.Close()
+
+	//the first utterance fits the quota, the second doesn't
+	audio := testAudio(time.Second, time.Second, time.Second, time.Second)
+	for _, key := range []string{"minute-key", "day-key"} {
+		code, err := quotaSession(t, server, key, audio)
+		if code != ErrCodeAudioQuota || !endedByPolicy(err) {
+			t.Errorf("%v: got code %q, %v", key, code, err)
+		}
+	}
+}
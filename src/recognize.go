@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cowdude/flapi/src/audio"
+	"github.com/cowdude/flapi/src/recognizer"
+	log "github.com/sirupsen/logrus"
+)
+
+// handleRecognize decodes a single segment, posted as a 16 bits mono PCM WAV
+// file, without transcoding nor activity detection. It is the upstream
+// endpoint of the remote recognizer.
+func handleRecognize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if isDraining() {
+		writeError(w, http.StatusServiceUnavailable, "server shutting down")
+		return
+	}
+	label, err := authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	select {
+	case <-asrReady:
+	default:
+		writeCodedError(w, http.StatusServiceUnavailable, ErrCodeASRNotReady, "ASR still warming up")
+		return
+	}
+
+	rlog := log.WithField("remote", r.RemoteAddr)
+	if label != "" {
+		rlog = rlog.WithField("key", label)
+	}
+	if id := r.Header.Get("X-Request-ID"); id != "" {
+		rlog = rlog.WithField("request", id)
+	}
+	format, data, err := audio.ReadWAV(limitBody(r.Body, Config().HTTP.MaxMessageSize))
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errBodyTooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		writeCodedError(w, code, ErrCodeInvalidAudio, err.Error())
+		return
+	}
+	seg := recognizer.Segment{Name: "recognize", Format: format, Frames: data}
+	if err = chargeAudio(label, seg.Duration()); err != nil {
+		qerr := err.(*QuotaError)
+		writeCodedError(w, http.StatusTooManyRequests, qerr.Code, qerr.Message)
+		return
+	}
+
+	pred, err := asr.Recognize(r.Context(), seg, recognizer.Options{
+		Session:    r.Header.Get("X-Request-ID"),
+		Background: r.Header.Get("X-Priority") == "background",
+	})
+	if err != nil {
+		rlog.WithError(err).Warn("recognize: prediction failed")
+		writeCodedError(w, http.StatusBadGateway, ErrCodePredictionFailure, err.Error())
+		return
+	}
+	rlog.WithField("decode", pred.Decode).Debugf("recognize: %v", pred.Text)
+	writeJSON(w, http.StatusOK, recognizer.RemoteResponse{
+		Text:      pred.Text,
+		QueueWait: pred.QueueWait.Seconds(),
+		Decode:    pred.Decode.Seconds(),
+		Duration:  seg.Duration().Seconds(),
+	})
+}
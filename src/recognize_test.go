@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cowdude/flapi/src/recognizer"
+)
+
+func TestRecognize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(handleRecognize))
+	defer server.Close()
+
+	res, err := http.Post(server.URL, "audio/wav", bytes.NewReader(testAudio(time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body recognizer.RemoteResponse
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || body.Text != testPrediction || body.Duration != 1 {
+		t.Errorf("unexpected response %v %+v", res.Status, body)
+	}
+}
+
+func TestRecognizeTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(handleRecognize))
+	defer server.Close()
+
+	audio := testAudio(time.Duration(Config().HTTP.MaxMessageSize/32000+1) * time.Second)
+	res, err := http.Post(server.URL, "audio/wav", bytes.NewReader(audio))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %v for %d bytes", res.Status, len(audio))
+	}
+}
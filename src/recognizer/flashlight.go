@@ -0,0 +1,540 @@
+package recognizer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FlashlightConfig holds the command-line options of the flashlight inference process.
+type FlashlightConfig struct {
+	Executable          string
+	AccousticModel      string `yaml:"accoustic_model"`
+	LanguageModel       string `yaml:"language_model"`
+	Tokens              string
+	Lexicon             string
+	BeamSize            int      `yaml:"beam_size"`             //The number of top hypothesis to preserve at each decoding step
+	BeamSizeToken       int      `yaml:"beam_size_token"`       //The number of top by acoustic model scores tokens set to be considered at each decoding step
+	BeamThreshold       int      `yaml:"beam_threshold"`        //Cut of hypothesis far away by the current score from the best hypothesis
+	LanguageModelWeight float64  `yaml:"language_model_weight"` //Language model weight to accumulate with acoustic model score
+	WordScore           float64  `yaml:"word_score"`            //Score to add when word finishes (lexicon-based beam search decoder only)
+	ExtraArgs           []string `yaml:"extra_args"`            //Additional command-line arguments
+}
+
+// DefaultFlashlightConfig returns the options of the models shipped in the docker image.
+func DefaultFlashlightConfig() FlashlightConfig {
+	return FlashlightConfig{
+		Executable:          "/root/flashlight/build/bin/asr/fl_asr_tutorial_inference_ctc",
+		AccousticModel:      "/data/am_transformer_ctc_stride3_letters_300Mparams.bin",
+		LanguageModel:       "/data/lm_common_crawl_large_4gram_prun0-0-5_200kvocab.bin",
+		Tokens:              "/data/tokens.txt",
+		Lexicon:             "/data/lexicon.txt",
+		BeamSize:            100,
+		BeamSizeToken:       10,
+		BeamThreshold:       100,
+		LanguageModelWeight: 3.0,
+	}
+}
+
+// Flashlight drives a flashlight inference process through its stdio, and
+// restarts it on request.
+type Flashlight struct {
+	ID     int
+	log    *log.Entry
+	config func() FlashlightConfig //evaluated at each (re)start of the process
+
+	queue      chan *asrRequest
+	background chan *asrRequest //requests of Options.Background, taken when queue is empty
+	done       chan struct{}
+	exited     chan struct{}
+	restart    chan struct{}
+	closeOnce  sync.Once
+
+	closeTimeout time.Duration //time given to the process to exit once its input is closed
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	started time.Time     //start time of the current process
+	pending []*asrRequest //requests sent to the process, waiting for their prediction
+
+	depth         int64
+	restarts      int64
+	running       int32
+	lastQueueWait int64 //nanoseconds
+	lastDecode    int64 //nanoseconds
+}
+
+type asrRequest struct {
+	file     string
+	enqueued time.Time
+	sent     time.Time
+	res      chan asrResult
+}
+
+type asrResult struct {
+	pred Prediction
+	err  error
+}
+
+const asrCloseTimeout = 10 * time.Second
+
+var runnerIDCounter int64
+
+var (
+	errASRExited    = errors.New("asr process exited")
+	errASRRestarted = errors.New("asr process restart requested")
+)
+
+func (req *asrRequest) fail(err error) {
+	req.res <- asrResult{err: err}
+}
+
+// Close stops sending inputs to the process, and waits for it to exit.
+// The process is killed if it doesn't exit within closeTimeout.
+func (runner *Flashlight) Close() (err error) {
+	runner.closeOnce.Do(func() { close(runner.done) })
+	kill := time.AfterFunc(runner.closeTimeout, func() {
+		runner.log.Warn("ASR process did not exit, killing it")
+		runner.mu.Lock()
+		if runner.cmd != nil && runner.cmd.Process != nil {
+			runner.cmd.Process.Kill()
+		}
+		runner.mu.Unlock()
+	})
+	defer kill.Stop()
+	<-runner.exited
+
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	if runner.cmd != nil && runner.cmd.ProcessState != nil && !runner.cmd.ProcessState.Exited() {
+		runner.log.Error("process leaked during Close")
+	}
+	return
+}
+
+// Restart asks the process to exit once it is done with its current input,
+// and starts a new one, with the current decoder settings. Queued predictions
+// are served by the new process.
+func (runner *Flashlight) Restart() {
+	select {
+	case runner.restart <- struct{}{}:
+	default: //a restart is already pending
+	}
+}
+
+// QueueDepth returns the number of predictions requested and not yet completed.
+func (runner *Flashlight) QueueDepth() int {
+	return int(atomic.LoadInt64(&runner.depth))
+}
+
+// Running tells whether the process is currently up.
+func (runner *Flashlight) Running() bool {
+	return atomic.LoadInt32(&runner.running) != 0
+}
+
+// Ready tells whether the process is up.
+func (runner *Flashlight) Ready() bool {
+	return runner.Running()
+}
+
+// State returns a snapshot of the runner and of its current process.
+func (runner *Flashlight) State() (state State) {
+	state = State{
+		Engine:        "flashlight",
+		ID:            runner.ID,
+		Running:       runner.Running(),
+		QueueDepth:    runner.QueueDepth(),
+		Restarts:      runner.Restarts(),
+		LastQueueWait: time.Duration(atomic.LoadInt64(&runner.lastQueueWait)).Seconds(),
+		LastDecode:    time.Duration(atomic.LoadInt64(&runner.lastDecode)).Seconds(),
+	}
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	state.Pending = len(runner.pending)
+	if state.Running && runner.cmd != nil && runner.cmd.Process != nil {
+		state.PID = runner.cmd.Process.Pid
+		state.Uptime = time.Since(runner.started).Seconds()
+	}
+	return
+}
+
+// Restarts returns the number of times the process was restarted.
+func (runner *Flashlight) Restarts() int {
+	return int(atomic.LoadInt64(&runner.restarts))
+}
+
+func (runner *Flashlight) transmit(w io.Writer, req *asrRequest, waitInput, exited <-chan struct{}) (err error) {
+	epoch := time.Now()
+	for timeout := time.Second * 15; ; timeout *= 2 {
+		select {
+		case <-runner.done:
+			return ErrClosed
+		case <-exited:
+			return errASRExited
+		case <-waitInput:
+			runner.log.Debugf("sending input: %v", req.file)
+			req.sent = time.Now()
+			runner.mu.Lock()
+			runner.pending = append(runner.pending, req)
+			runner.mu.Unlock()
+			w.Write([]byte(req.file))
+			_, err = w.Write([]byte{'\n'})
+			return
+		case now := <-time.After(timeout):
+			elapsed := now.Sub(epoch)
+			metricFallingBehind.Inc()
+			runner.log.Warnf("process is falling behind for %v", elapsed.Truncate(time.Second))
+		}
+	}
+}
+
+// complete delivers a prediction to the oldest pending request.
+func (runner *Flashlight) complete(pred Prediction) {
+	runner.mu.Lock()
+	if len(runner.pending) == 0 {
+		runner.mu.Unlock()
+		runner.log.Panicf("Received unrequested prediction for '%v'", pred.InputFile)
+	}
+	req := runner.pending[0]
+	runner.pending = runner.pending[1:]
+	runner.mu.Unlock()
+
+	if pred.InputFile != req.file {
+		runner.log.Panicf("Received prediction for '%v' instead of '%v'", pred.InputFile, req.file)
+	}
+	pred.Runner = runner.ID
+	pred.QueueWait = req.sent.Sub(req.enqueued)
+	pred.Decode = time.Since(req.sent)
+	atomic.StoreInt64(&runner.lastQueueWait, int64(pred.QueueWait))
+	atomic.StoreInt64(&runner.lastDecode, int64(pred.Decode))
+	metricQueueWait.Observe(pred.QueueWait.Seconds())
+	metricDecode.Observe(pred.Decode.Seconds())
+	req.res <- asrResult{pred: pred}
+}
+
+func (runner *Flashlight) failPending(err error) {
+	runner.mu.Lock()
+	pending := runner.pending
+	runner.pending = nil
+	runner.mu.Unlock()
+	for _, req := range pending {
+		req.fail(err)
+	}
+}
+
+// Run starts the process, and starts it again on each Restart, until the
+// runner is closed. It returns early if the process can't be started, or
+// exits unexpectedly.
+func (runner *Flashlight) Run() (err error) {
+	defer close(runner.exited)
+	for {
+		if err = runner.runProcess(); err != errASRRestarted {
+			return
+		}
+		select {
+		case <-runner.done:
+			return
+		default:
+		}
+		atomic.AddInt64(&runner.restarts, 1)
+		metricRestarts.Inc()
+		runner.log.Println("Restarting ASR process")
+	}
+}
+
+func (runner *Flashlight) runProcess() (err error) {
+	var input io.WriteCloser
+	var output io.ReadCloser
+	cfg := runner.config()
+	args := flashlightArgs(cfg)
+	runner.log.Debugf("args: %v", strings.Join(args, " "))
+	cmd := exec.Command(cfg.Executable, args...)
+	if input, err = cmd.StdinPipe(); err != nil {
+		return
+	}
+	if output, err = cmd.StderrPipe(); err != nil {
+		return
+	}
+
+	runner.log.Debug("starting process")
+	if err = cmd.Start(); err != nil {
+		return
+	}
+	runner.mu.Lock()
+	runner.cmd = cmd
+	runner.started = time.Now()
+	runner.mu.Unlock()
+	atomic.StoreInt32(&runner.running, 1)
+	defer atomic.StoreInt32(&runner.running, 0)
+	plog := runner.log.WithField("pid", cmd.Process.Pid)
+	plog.Println("ASR process started")
+
+	var (
+		wg         sync.WaitGroup
+		restarting bool
+		waitInput  = make(chan struct{}, 1)
+		inputReady = make(chan struct{}, 1) //wakes up the input loop when waitInput is signaled
+		exited     = make(chan struct{})
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer input.Close()
+		send := func(req *asrRequest) bool {
+			if err := runner.transmit(input, req, waitInput, exited); err != nil {
+				plog.Errorf("failed to send input to ASR: %v", err)
+				if req.sent.IsZero() {
+					req.fail(err)
+				} //otherwise, the request is pending and fails once the process exits
+				return false
+			}
+			return true
+		}
+		for {
+			//background requests are only taken once the process waits for
+			//input, so that interactive requests queued meanwhile go first
+			var background chan *asrRequest
+			if len(waitInput) != 0 {
+				select {
+				case req := <-runner.queue:
+					if !send(req) {
+						return
+					}
+					continue
+				default:
+				}
+				background = runner.background
+			}
+			select {
+			case <-runner.done:
+				return
+			case <-exited:
+				return
+			case <-runner.restart:
+				plog.Println("Restart requested, closing the process input")
+				restarting = true
+				go func() {
+					select {
+					case <-exited:
+					case <-time.After(runner.closeTimeout):
+						plog.Warn("ASR process did not exit, killing it")
+						cmd.Process.Kill()
+					}
+				}()
+				return
+			case <-inputReady:
+			case req := <-runner.queue:
+				if !send(req) {
+					return
+				}
+			case req := <-background:
+				if !send(req) {
+					return
+				}
+			}
+		}
+	}()
+
+	go func() {
+		const (
+			predictedOutputStr = `[Inference tutorial for CTC]: predicted output for `
+			waitingInputStr    = `[Inference tutorial for CTC]: Waiting the input`
+		)
+		defer wg.Done()
+		defer close(exited)
+		var (
+			scanner        = bufio.NewScanner(output)
+			readingPred    bool
+			predictionFile string
+			prediction     strings.Builder
+		)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.Contains(line, waitingInputStr) {
+				//process is now waiting for input file path
+				if readingPred {
+					runner.complete(Prediction{
+						InputFile: predictionFile,
+						Text:      prediction.String(),
+					})
+					prediction.Reset()
+					predictionFile = ""
+					readingPred = false
+				}
+				plog.Debug("[RX]ASR waiting for input")
+				select {
+				case waitInput <- struct{}{}:
+				default:
+				}
+				select {
+				case inputReady <- struct{}{}:
+				default:
+				}
+			} else if pos := strings.LastIndex(line, predictedOutputStr); pos != -1 {
+				//process is now telling prediction for a given file path
+				if readingPred {
+					runner.log.Panicf("stdio parse state violation at predicted output: '%v'", line)
+				}
+				predictionFile = strings.TrimSpace(line[pos+len(predictedOutputStr):])
+				readingPred = true
+			} else if readingPred {
+				//process is telling prediction
+				if prediction.Len() != 0 {
+					prediction.WriteRune('\n')
+				}
+				prediction.WriteString(line)
+			} else {
+				//unparsed process logs
+				logFlashlightLine(plog, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			plog.Error(err)
+		}
+	}()
+
+	wg.Wait()
+	err = cmd.Wait()
+	runner.failPending(errASRExited)
+	if restarting && err == nil {
+		err = errASRRestarted
+	}
+	return
+}
+
+// Recognize writes the segment to a temporary WAV file, and feeds it to the process.
+func (runner *Flashlight) Recognize(ctx context.Context, seg Segment, opts Options) (res Prediction, err error) {
+	f, err := os.CreateTemp("", seg.Name+"_*.wav")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+
+	if err = seg.WriteWAV(f); err != nil {
+		f.Close()
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
+	}
+	opts.logEntry(runner.log).Debugf("wrote tmp WAV file: %v", f.Name())
+	if opts.Background {
+		return runner.predictFile(ctx, f.Name(), runner.background)
+	}
+	return runner.PredictFile(ctx, f.Name())
+}
+
+// PredictFile feeds a WAV file to the process, and waits for its prediction.
+// The context only bounds the wait for the process to accept the file: the
+// file must exist until PredictFile returns.
+func (runner *Flashlight) PredictFile(ctx context.Context, inputFile string) (res Prediction, err error) {
+	return runner.predictFile(ctx, inputFile, runner.queue)
+}
+
+func (runner *Flashlight) predictFile(ctx context.Context, inputFile string, queue chan<- *asrRequest) (res Prediction, err error) {
+	epoch := time.Now()
+	defer func() {
+		elapsed := time.Since(epoch)
+		runner.log.Debugf("end-to-end ASR prediction took %v", elapsed)
+	}()
+
+	atomic.AddInt64(&runner.depth, 1)
+	defer atomic.AddInt64(&runner.depth, -1)
+	req := &asrRequest{
+		file:     inputFile,
+		enqueued: epoch,
+		res:      make(chan asrResult, 1),
+	}
+	select {
+	case queue <- req:
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	case <-runner.done:
+		err = ErrClosed
+		return
+	case <-runner.exited:
+		err = errASRExited
+		return
+	}
+	result := <-req.res
+	return result.pred, result.err
+}
+
+// flashlightArgs returns the command line of the flashlight process.
+// It is evaluated at each (re)start, so that decoder settings can be reloaded.
+func flashlightArgs(cfg FlashlightConfig) (args []string) {
+	//empty paths are left out, for stand-ins such as cmd/fake-flashlight
+	for _, path := range []struct{ flag, value string }{
+		{`--am_path=`, cfg.AccousticModel},
+		{`--tokens_path=`, cfg.Tokens},
+		{`--lexicon_path=`, cfg.Lexicon},
+		{`--lm_path=`, cfg.LanguageModel},
+	} {
+		if path.value != "" {
+			args = append(args, path.flag+path.value)
+		}
+	}
+	args = append(args,
+		`--logtostderr=true`,
+		`--sample_rate=16000`,
+		fmt.Sprintf(`--beam_size=%v`, cfg.BeamSize),
+		fmt.Sprintf(`--beam_size_token=%v`, cfg.BeamSizeToken),
+		fmt.Sprintf(`--beam_threshold=%v`, cfg.BeamThreshold),
+		fmt.Sprintf(`--lm_weight=%v`, cfg.LanguageModelWeight),
+		fmt.Sprintf(`--word_score=%v`, cfg.WordScore),
+	)
+	return append(args, cfg.ExtraArgs...)
+}
+
+// NewFlashlight returns a runner for the flashlight inference process. The
+// config function is called at each start of the process, so that decoder
+// settings can be changed through Restart.
+func NewFlashlight(config func() FlashlightConfig) *Flashlight {
+	id := atomic.AddInt64(&runnerIDCounter, 1)
+	return &Flashlight{
+		ID:           int(id),
+		log:          log.WithField("runner", id),
+		config:       config,
+		queue:        make(chan *asrRequest),
+		background:   make(chan *asrRequest),
+		done:         make(chan struct{}),
+		exited:       make(chan struct{}),
+		restart:      make(chan struct{}, 1),
+		closeTimeout: asrCloseTimeout,
+	}
+}
+
+// glogLine matches flashlight's glog lines, such as:
+// I0226 12:34:56.789012    42 InferenceCTC.cpp:123] message
+var glogLine = regexp.MustCompile(`^([IWEF])(\d{4} \d{2}:\d{2}:\d{2}\.\d+)\s+(\d+) ([^ \]]+:\d+)\] ?(.*)$`)
+
+// logFlashlightLine re-emits a line of the flashlight logs as a structured entry.
+func logFlashlightLine(entry *log.Entry, line string) {
+	entry = entry.WithField("source", "flashlight")
+	m := glogLine.FindStringSubmatch(line)
+	if m == nil {
+		entry.Info(line)
+		return
+	}
+	entry = entry.WithField("fl_caller", m[4]).WithField("fl_thread", m[3])
+	switch m[1] {
+	case "W":
+		entry.Warn(m[5])
+	case "E", "F":
+		entry.Error(m[5])
+	default:
+		entry.Info(m[5])
+	}
+}
@@ -0,0 +1,145 @@
+package recognizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFlashlight is the path of cmd/fake-flashlight, built by TestMain.
+var fakeFlashlight string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "flapi-recognizer-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fakeFlashlight = filepath.Join(dir, "fake-flashlight")
+	build := exec.Command("go", "build", "-o", fakeFlashlight, "github.com/cowdude/flapi/src/cmd/fake-flashlight")
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	code := 1
+	if err = build.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to build fake-flashlight:", err)
+	} else {
+		code = m.Run()
+	}
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// startFake runs a flashlight runner on the fake, following the given script.
+// Run's result is sent on the returned channel.
+func startFake(t *testing.T, script ...string) (*Flashlight, <-chan error) {
+	path := filepath.Join(t.TempDir(), "script.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(script, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultFlashlightConfig()
+	cfg.Executable = fakeFlashlight
+	cfg.AccousticModel, cfg.LanguageModel, cfg.Tokens, cfg.Lexicon = "", "", "", ""
+	cfg.ExtraArgs = []string{"--fake_script=" + path}
+	runner := NewFlashlight(func() FlashlightConfig { return cfg })
+	exited := make(chan error, 1)
+	go func() { exited <- runner.Run() }()
+	t.Cleanup(func() { runner.Close() })
+	return runner, exited
+}
+
+func recognize(runner *Flashlight) (string, error) {
+	pred, err := runner.Recognize(context.Background(), testSegment, Options{})
+	return pred.Text, err
+}
+
+func TestFlashlightScript(t *testing.T) {
+	runner, _ := startFake(t, "hello world", "!empty", "!delay 50ms good bye")
+	for i, want := range []string{"hello world", "", "good bye", "hello world"} {
+		pred, err := runner.Recognize(context.Background(), testSegment, Options{Background: i%2 == 0})
+		if err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+		if pred.Text != want {
+			t.Errorf("input %d: predicted %q, want %q", i, pred.Text, want)
+		}
+		if i == 2 && pred.Decode < 50*time.Millisecond {
+			t.Errorf("input %d: decoded in %v, despite the scripted delay", i, pred.Decode)
+		}
+	}
+}
+
+func TestFlashlightCrash(t *testing.T) {
+	runner, exited := startFake(t, "hello world", "!crash")
+	if text, err := recognize(runner); err != nil || text != "hello world" {
+		t.Fatalf("got %q, %v before the crash", text, err)
+	}
+	if _, err := recognize(runner); err == nil {
+		t.Fatal("no error on crash")
+	}
+	select {
+	case err := <-exited:
+		if err == nil {
+			t.Error("Run returned no error after a crash")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after a crash")
+	}
+	//the runner is gone: segments fail instead of waiting forever
+	if _, err := recognize(runner); err == nil {
+		t.Error("no error after the crash")
+	}
+}
+
+func TestFlashlightHang(t *testing.T) {
+	runner, exited := startFake(t, "!hang")
+	runner.closeTimeout = 100 * time.Millisecond
+	res := make(chan error, 1)
+	go func() {
+		_, err := recognize(runner)
+		res <- err
+	}()
+	select {
+	case err := <-res:
+		t.Fatalf("hanging process answered: %v", err)
+	case err := <-exited:
+		t.Fatalf("hanging process exited: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+	if !runner.Running() {
+		t.Fatal("hanging process is not running")
+	}
+
+	runner.Close() //kills the process after closeTimeout
+	select {
+	case err := <-res:
+		if err == nil {
+			t.Error("no error for the input of a killed process")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("input still pending after Close")
+	}
+}
+
+func TestFlashlightRestart(t *testing.T) {
+	runner, _ := startFake(t, "hello world")
+	if _, err := recognize(runner); err != nil {
+		t.Fatal(err)
+	}
+	pid := runner.State().PID
+	runner.Restart()
+	for deadline := time.Now().Add(5 * time.Second); runner.Restarts() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("process not restarted")
+		}
+	}
+	if text, err := recognize(runner); err != nil || text != "hello world" {
+		t.Fatalf("got %q, %v after the restart", text, err)
+	}
+	if state := runner.State(); state.PID == pid || state.Restarts != 1 {
+		t.Errorf("unexpected state after the restart: %+v", state)
+	}
+}
@@ -0,0 +1,27 @@
+package recognizer
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricQueueWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "flapi_asr_queue_wait_seconds",
+		Help:    "Time spent by segments waiting for the ASR process to accept them.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	})
+	metricDecode = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "flapi_asr_decode_seconds",
+		Help:    "Time spent by the ASR process decoding segments.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	})
+	metricRestarts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "flapi_asr_restarts_total",
+		Help: "Restarts of the ASR process.",
+	})
+	metricFallingBehind = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "flapi_asr_falling_behind_total",
+		Help: "Times a segment waited too long for the ASR process to accept it.",
+	})
+)
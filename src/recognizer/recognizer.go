@@ -0,0 +1,94 @@
+// Package recognizer turns audio segments into text. The server, and the
+// command-line tools, use a Recognizer without knowing which engine is behind it.
+package recognizer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/cowdude/flapi/src/audio"
+	log "github.com/sirupsen/logrus"
+)
+
+// Recognizer transcribes audio segments. Implementations are safe for concurrent use.
+type Recognizer interface {
+	// Recognize transcribes a segment. Cancelling the context abandons the
+	// segment, although some engines always complete the segments they
+	// started working on.
+	Recognize(ctx context.Context, seg Segment, opts Options) (Prediction, error)
+	// Ready tells whether the engine can currently take segments.
+	Ready() bool
+	// State returns a snapshot of the engine, for health checks and the admin API.
+	State() State
+	// Run serves segments until Close is called. It returns early if the
+	// engine can't be started, or fails.
+	Run() error
+	// Restart restarts the engine once it is done with its current segment,
+	// so that it picks up new settings.
+	Restart()
+	// Close stops the engine, and waits until it is done.
+	Close() error
+}
+
+// Segment is a span of 16 bits mono PCM audio.
+type Segment struct {
+	Name   string         //name of the segment, for temporary files and logs
+	Format audio.WAVEInfo //format of Frames
+	Frames []byte
+}
+
+// Duration returns the playback duration of the segment.
+func (seg Segment) Duration() time.Duration {
+	return seg.Format.Duration(len(seg.Frames))
+}
+
+// WriteWAV writes the segment as a WAV file.
+func (seg Segment) WriteWAV(w io.Writer) error {
+	if err := audio.WriteWAVHeader(w, seg.Format.WithDataSize(len(seg.Frames))); err != nil {
+		return err
+	}
+	_, err := w.Write(seg.Frames)
+	return err
+}
+
+// Options tune the recognition of a single segment.
+type Options struct {
+	Session    string //ID of the session the segment belongs to, for logs
+	Background bool   //segment of a batch job: engines serve the segments of interactive sessions first
+}
+
+func (opts Options) logEntry(entry *log.Entry) *log.Entry {
+	if opts.Session != "" {
+		entry = entry.WithField("guid", opts.Session)
+	}
+	return entry
+}
+
+type Prediction struct {
+	InputFile string `json:"input_file"`
+	Text      string `json:"text"`
+	Segment   uint   `json:"segment"`
+
+	QueueWait time.Duration `json:"-"` //time spent waiting for the engine to accept the input
+	Decode    time.Duration `json:"-"` //time spent by the engine on the input
+	Runner    int           `json:"-"` //ID of the runner that made the prediction
+}
+
+// State is a snapshot of a Recognizer. Fields that don't apply to an engine are left empty.
+type State struct {
+	Engine        string  `json:"engine"`
+	ID            int     `json:"id,omitempty"`
+	PID           int     `json:"pid,omitempty"`
+	Running       bool    `json:"running"`
+	Uptime        float64 `json:"uptime_seconds"`
+	QueueDepth    int     `json:"queue_depth"`
+	Pending       int     `json:"pending"`
+	Restarts      int     `json:"restarts"`
+	LastQueueWait float64 `json:"last_queue_wait_seconds"`
+	LastDecode    float64 `json:"last_decode_seconds"`
+}
+
+// ErrClosed is returned by Recognize once the recognizer is closed.
+var ErrClosed = errors.New("recognizer closed")
@@ -0,0 +1,273 @@
+package recognizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RemoteConfig tunes the remote recognizer.
+type RemoteConfig struct {
+	Upstreams       []string      //URLs of the upstream batch endpoints, such as http://gpu1:8080/v1/recognize
+	APIKey          string        `yaml:"api_key"` //sent in the X-API-Key header
+	Timeout         time.Duration //timeout of each attempt
+	Retries         int           //additional attempts on other upstreams, after an upstream failure
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`    //wait before each retry
+	FailureCooldown time.Duration `yaml:"failure_cooldown"` //upstreams that failed are avoided for this long
+}
+
+// DefaultRemoteConfig returns the remote settings used when not configured.
+func DefaultRemoteConfig() RemoteConfig {
+	return RemoteConfig{
+		Timeout:         30 * time.Second,
+		Retries:         2,
+		RetryBackoff:    100 * time.Millisecond,
+		FailureCooldown: 5 * time.Second,
+	}
+}
+
+// RemoteResponse is the response of an upstream batch endpoint. Only the text is required.
+type RemoteResponse struct {
+	Text      string  `json:"text"`
+	QueueWait float64 `json:"queue_wait_seconds,omitempty"`
+	Decode    float64 `json:"decode_seconds,omitempty"`
+	Duration  float64 `json:"duration_seconds,omitempty"`
+}
+
+// upstream is a remote endpoint, and its load.
+type upstream struct {
+	url         string
+	inFlight    int64
+	failedUntil int64 //unix nanoseconds
+}
+
+func (u *upstream) healthy(now time.Time) bool {
+	return now.UnixNano() >= atomic.LoadInt64(&u.failedUntil)
+}
+
+// Remote is a Recognizer that forwards segments, as WAV files, to the batch
+// endpoint of other flapi instances, or of any service that implements the
+// same request/response schema. Each segment goes to the healthy upstream
+// with the fewest segments in flight; failed attempts are retried on other
+// upstreams.
+type Remote struct {
+	config func() RemoteConfig
+	client *http.Client
+	log    *log.Entry
+
+	mu        sync.Mutex
+	upstreams map[string]*upstream
+	next      int //round-robin offset, to spread ties
+
+	done       chan struct{}
+	closeOnce  sync.Once
+	depth      int64
+	lastDecode int64 //nanoseconds
+}
+
+// errUpstream is a failure worth retrying on another upstream.
+type errUpstream struct {
+	url string
+	err error
+}
+
+func (e *errUpstream) Error() string { return fmt.Sprintf("upstream %v: %v", e.url, e.err) }
+func (e *errUpstream) Unwrap() error { return e.err }
+
+// NewRemote returns a remote recognizer. The config function is called for each segment.
+func NewRemote(config func() RemoteConfig) *Remote {
+	return &Remote{
+		config:    config,
+		client:    &http.Client{},
+		log:       log.WithField("engine", "remote"),
+		upstreams: make(map[string]*upstream),
+		done:      make(chan struct{}),
+	}
+}
+
+// pick returns the upstream to send the next attempt to, avoiding the ones
+// already tried. It returns nil once they were all tried.
+func (remote *Remote) pick(urls []string, tried map[*upstream]bool) *upstream {
+	remote.mu.Lock()
+	defer remote.mu.Unlock()
+	now := time.Now()
+	var best *upstream
+	var bestHealthy bool
+	for i := range urls {
+		url := urls[(remote.next+i)%len(urls)]
+		u, ok := remote.upstreams[url]
+		if !ok {
+			u = &upstream{url: url}
+			remote.upstreams[url] = u
+		}
+		if tried[u] {
+			continue
+		}
+		healthy := u.healthy(now)
+		switch {
+		case best == nil,
+			healthy && !bestHealthy,
+			healthy == bestHealthy && atomic.LoadInt64(&u.inFlight) < atomic.LoadInt64(&best.inFlight):
+			best, bestHealthy = u, healthy
+		}
+	}
+	remote.next++
+	return best
+}
+
+func (remote *Remote) Recognize(ctx context.Context, seg Segment, opts Options) (pred Prediction, err error) {
+	atomic.AddInt64(&remote.depth, 1)
+	defer atomic.AddInt64(&remote.depth, -1)
+	select {
+	case <-remote.done:
+		return pred, ErrClosed
+	default:
+	}
+
+	cfg := remote.config()
+	if len(cfg.Upstreams) == 0 {
+		return pred, errors.New("no upstream configured")
+	}
+	var body bytes.Buffer
+	if err = seg.WriteWAV(&body); err != nil {
+		return
+	}
+
+	tried := make(map[*upstream]bool)
+	for attempt := 0; attempt <= cfg.Retries; attempt++ {
+		if attempt != 0 {
+			select {
+			case <-ctx.Done():
+				return pred, ctx.Err()
+			case <-remote.done:
+				return pred, ErrClosed
+			case <-time.After(cfg.RetryBackoff):
+			}
+		}
+		u := remote.pick(cfg.Upstreams, tried)
+		if u == nil { //every upstream failed once, try them again
+			tried = make(map[*upstream]bool)
+			u = remote.pick(cfg.Upstreams, tried)
+		}
+		tried[u] = true
+		pred, err = remote.send(ctx, cfg, u, body.Bytes(), opts)
+		var uerr *errUpstream
+		if err == nil || !errors.As(err, &uerr) || ctx.Err() != nil {
+			break
+		}
+		atomic.StoreInt64(&u.failedUntil, time.Now().Add(cfg.FailureCooldown).UnixNano())
+		opts.logEntry(remote.log).WithField("attempt", attempt+1).Warn(err)
+	}
+	if err == nil {
+		pred.InputFile = seg.Name
+		atomic.StoreInt64(&remote.lastDecode, int64(pred.Decode))
+	}
+	return
+}
+
+// send makes a single attempt. Network errors, timeouts, 429 and 5xx
+// responses are upstream failures, which may be retried elsewhere.
+func (remote *Remote) send(ctx context.Context, cfg RemoteConfig, u *upstream, wav []byte, opts Options) (pred Prediction, err error) {
+	atomic.AddInt64(&u.inFlight, 1)
+	defer atomic.AddInt64(&u.inFlight, -1)
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url, bytes.NewReader(wav))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "audio/wav")
+	if cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", cfg.APIKey)
+	}
+	if opts.Session != "" {
+		req.Header.Set("X-Request-ID", opts.Session)
+	}
+	if opts.Background {
+		req.Header.Set("X-Priority", "background")
+	}
+
+	epoch := time.Now()
+	res, err := remote.client.Do(req)
+	if err != nil {
+		return pred, &errUpstream{u.url, err}
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		err = fmt.Errorf("%v: %s", res.Status, bytes.TrimSpace(msg))
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+			err = &errUpstream{u.url, err}
+		}
+		return
+	}
+	var body RemoteResponse
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return pred, &errUpstream{u.url, fmt.Errorf("invalid response: %w", err)}
+	}
+	elapsed := time.Since(epoch)
+	pred.Text = body.Text
+	pred.QueueWait = time.Duration(body.QueueWait * float64(time.Second))
+	pred.Decode = time.Duration(body.Decode * float64(time.Second))
+	if pred.Decode == 0 {
+		pred.Decode = elapsed
+	}
+	return
+}
+
+// Ready tells whether an upstream is configured, and at least one of them didn't fail recently.
+func (remote *Remote) Ready() bool {
+	select {
+	case <-remote.done:
+		return false
+	default:
+	}
+	now := time.Now()
+	for _, url := range remote.config().Upstreams {
+		remote.mu.Lock()
+		u, ok := remote.upstreams[url]
+		remote.mu.Unlock()
+		if !ok || u.healthy(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (remote *Remote) State() State {
+	return State{
+		Engine:     "remote",
+		Running:    remote.Ready(),
+		QueueDepth: int(atomic.LoadInt64(&remote.depth)),
+		LastDecode: time.Duration(atomic.LoadInt64(&remote.lastDecode)).Seconds(),
+	}
+}
+
+func (remote *Remote) Run() error {
+	<-remote.done
+	return ErrClosed
+}
+
+// Restart forgets about the past failures of the upstreams.
+func (remote *Remote) Restart() {
+	remote.mu.Lock()
+	remote.upstreams = make(map[string]*upstream)
+	remote.mu.Unlock()
+}
+
+func (remote *Remote) Close() error {
+	remote.closeOnce.Do(func() { close(remote.done) })
+	return nil
+}
@@ -0,0 +1,104 @@
+package recognizer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// upstreamStub is a stand-in batch endpoint, answering with the given status.
+type upstreamStub struct {
+	*httptest.Server
+	hits     int64
+	priority atomic.Value
+}
+
+func newUpstreamStub(t *testing.T, status int, text string) *upstreamStub {
+	stub := new(upstreamStub)
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&stub.hits, 1)
+		stub.priority.Store(r.Header.Get("X-Priority"))
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		json.NewEncoder(w).Encode(RemoteResponse{Text: text, Decode: 0.25})
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func newTestRemote(upstreams ...string) *Remote {
+	cfg := DefaultRemoteConfig()
+	cfg.Upstreams = upstreams
+	cfg.RetryBackoff = time.Millisecond
+	return NewRemote(func() RemoteConfig { return cfg })
+}
+
+var testSegment = Segment{Name: "seg", Frames: make([]byte, 3200)}
+
+func TestRemoteFailover(t *testing.T) {
+	down := newUpstreamStub(t, http.StatusServiceUnavailable, "")
+	up := newUpstreamStub(t, http.StatusOK, "hello world")
+	remote := newTestRemote(down.URL, up.URL)
+	defer remote.Close()
+
+	for i := 0; i < 3; i++ {
+		pred, err := remote.Recognize(context.Background(), testSegment, Options{Background: true})
+		if err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+		if pred.Text != "hello world" || pred.Decode != 250*time.Millisecond || pred.InputFile != "seg" {
+			t.Fatalf("attempt %d: unexpected prediction %+v", i, pred)
+		}
+	}
+	//the failed upstream is avoided during its cooldown
+	if hits := atomic.LoadInt64(&down.hits); hits > 1 {
+		t.Errorf("failed upstream tried %d times during its cooldown", hits)
+	}
+	if priority := up.priority.Load(); priority != "background" {
+		t.Errorf("X-Priority = %q, want background", priority)
+	}
+	if !remote.Ready() {
+		t.Error("not ready with a healthy upstream")
+	}
+}
+
+func TestRemoteAllUpstreamsDown(t *testing.T) {
+	down := newUpstreamStub(t, http.StatusBadGateway, "")
+	//duplicates are rejected by the server config, but not by the package
+	remote := newTestRemote(down.URL, down.URL)
+	defer remote.Close()
+
+	_, err := remote.Recognize(context.Background(), testSegment, Options{})
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("expected the upstream failure, got %v", err)
+	}
+	if hits, want := atomic.LoadInt64(&down.hits), int64(1+DefaultRemoteConfig().Retries); hits != want {
+		t.Errorf("upstream tried %d times, want %d", hits, want)
+	}
+	if remote.Ready() {
+		t.Error("ready while every upstream is cooling down")
+	}
+}
+
+func TestRemoteClientErrorNotRetried(t *testing.T) {
+	bad := newUpstreamStub(t, http.StatusBadRequest, "")
+	remote := newTestRemote(bad.URL)
+	defer remote.Close()
+
+	if _, err := remote.Recognize(context.Background(), testSegment, Options{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if hits := atomic.LoadInt64(&bad.hits); hits != 1 {
+		t.Errorf("client error retried: %d attempts", hits)
+	}
+	if !remote.Ready() {
+		t.Error("client errors put the upstream on cooldown")
+	}
+}
@@ -0,0 +1,109 @@
+package recognizer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StubConfig tunes the stub recognizer.
+type StubConfig struct {
+	Text  string        //prediction returned for every segment
+	Delay time.Duration //simulated decoding time
+}
+
+// Stub is a Recognizer that doesn't decode anything: it returns the same text
+// for every segment, after a fixed delay. Segments are served one at a time,
+// like a single flashlight process would, background segments last.
+type Stub struct {
+	config func() StubConfig
+
+	mu        sync.Mutex
+	idle      *sync.Cond //signaled when busy goes false
+	busy      bool       //a segment is being "decoded"
+	waiting   int        //interactive segments waiting for the stub
+	done      chan struct{}
+	closeOnce sync.Once
+	depth     int64
+}
+
+// NewStub returns a stub recognizer. The config function is called for each segment.
+func NewStub(config func() StubConfig) *Stub {
+	stub := &Stub{
+		config: config,
+		done:   make(chan struct{}),
+	}
+	stub.idle = sync.NewCond(&stub.mu)
+	return stub
+}
+
+func (stub *Stub) Recognize(ctx context.Context, seg Segment, opts Options) (pred Prediction, err error) {
+	atomic.AddInt64(&stub.depth, 1)
+	defer atomic.AddInt64(&stub.depth, -1)
+	epoch := time.Now()
+	stub.mu.Lock()
+	if !opts.Background {
+		stub.waiting++
+	}
+	for stub.busy || opts.Background && stub.waiting > 0 {
+		stub.idle.Wait()
+	}
+	if !opts.Background {
+		stub.waiting--
+	}
+	stub.busy = true
+	stub.mu.Unlock()
+	defer func() {
+		stub.mu.Lock()
+		stub.busy = false
+		stub.mu.Unlock()
+		stub.idle.Broadcast()
+	}()
+	select {
+	case <-stub.done:
+		return pred, ErrClosed
+	case <-ctx.Done():
+		return pred, ctx.Err()
+	default:
+	}
+
+	cfg := stub.config()
+	sent := time.Now()
+	time.Sleep(cfg.Delay)
+	return Prediction{
+		InputFile: seg.Name,
+		Text:      cfg.Text,
+		QueueWait: sent.Sub(epoch),
+		Decode:    time.Since(sent),
+	}, nil
+}
+
+func (stub *Stub) Ready() bool {
+	select {
+	case <-stub.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (stub *Stub) State() State {
+	return State{
+		Engine:     "stub",
+		Running:    stub.Ready(),
+		QueueDepth: int(atomic.LoadInt64(&stub.depth)),
+	}
+}
+
+func (stub *Stub) Run() error {
+	<-stub.done
+	return ErrClosed
+}
+
+func (stub *Stub) Restart() {}
+
+func (stub *Stub) Close() error {
+	stub.closeOnce.Do(func() { close(stub.done) })
+	return nil
+}
@@ -0,0 +1,635 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cowdude/flapi/src/audio"
+	"github.com/cowdude/flapi/src/recognizer"
+	log "github.com/sirupsen/logrus"
+)
+
+// Session is the audio pipeline of a client, whatever its transport:
+// input buffer → ffmpeg transcoder → activity scanner → recognizer.
+// Transports feed it audio with Write, and deliver the events it queues
+// with SendEvent; a single goroutine of the transport reads Events.
+type Session struct {
+	GUID      string
+	KeyLabel  string //label of the API key used by the client, if any
+	Transport string //websocket, grpc, watch or job
+	Remote    string //remote address of the client, or path of the audio file
+	Connected time.Time
+	Audio     struct {
+		In       *audio.InputBuffer
+		InfoC    chan audio.WAVEInfo
+		Activity chan audio.Activity
+	}
+
+	cfg        *Configuration //configuration at the time the session started
+	background bool           //see SessionOptions.Background
+	out        chan EventPayload
+	audioSeen  chan struct{}
+	runDone    chan struct{}
+	log        *log.Entry
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+
+	endEx     sync.Mutex
+	endReason EndReason
+	endMsg    string
+	ended     bool
+
+	bytesIn   int64 //audio bytes received
+	bytesLost int64 //audio bytes lost to input buffer overflows
+	pcmBytes  int64 //PCM bytes read from the transcoder
+	segments  int64 //segments predicted
+	pending   int64 //predictions requested and not yet completed
+}
+
+// EndReason tells transports why a session ended, so that they can pick
+// their own close or status code.
+type EndReason int
+
+const (
+	EndNormal       EndReason = iota //the input ended, or the client left
+	EndIdle                          //no audio was received for http.idle_timeout
+	EndSlowConsumer                  //the client doesn't read its events fast enough
+	EndPolicy                        //a quota or limit was hit
+	EndKicked                        //disconnected by an administrator
+	EndShutdown                      //the server is shutting down
+	EndUnsupported                   //the client sent something the transport doesn't support
+	EndError                         //internal error
+)
+
+var endReasonNames = [...]string{
+	EndNormal:       "normal",
+	EndIdle:         "idle",
+	EndSlowConsumer: "slow_consumer",
+	EndPolicy:       "policy",
+	EndKicked:       "kicked",
+	EndShutdown:     "shutdown",
+	EndUnsupported:  "unsupported",
+	EndError:        "error",
+}
+
+func (reason EndReason) String() string {
+	if int(reason) < len(endReasonNames) {
+		return endReasonNames[reason]
+	}
+	return fmt.Sprintf("EndReason(%d)", int(reason))
+}
+
+// ClientInfo is a snapshot of a client session, for the admin API.
+type ClientInfo struct {
+	GUID      string    `json:"guid"`
+	Key       string    `json:"key,omitempty"`
+	Transport string    `json:"transport"`
+	Remote    string    `json:"remote_addr"`
+	Connected time.Time `json:"connected_at"`
+	BytesIn   int64     `json:"bytes_in"`
+	Segments  int64     `json:"segments"`
+	Pending   int64     `json:"pending_predictions"`
+}
+
+var (
+	sessions   = make(map[string]*Session)
+	sessionsEx sync.Mutex
+)
+
+// DispatchEvent sends an event to every session.
+func DispatchEvent(payload EventPayload) {
+	sessionsEx.Lock()
+	for _, session := range sessions {
+		session.SendEvent(payload)
+	}
+	sessionsEx.Unlock()
+}
+
+func registerSession(s *Session) {
+	sessionsEx.Lock()
+	sessions[s.GUID] = s
+	sessionsEx.Unlock()
+}
+
+func unregisterSession(s *Session) {
+	sessionsEx.Lock()
+	delete(sessions, s.GUID)
+	sessionsEx.Unlock()
+}
+
+func findSession(guid string) (s *Session, ok bool) {
+	sessionsEx.Lock()
+	defer sessionsEx.Unlock()
+	s, ok = sessions[guid]
+	return
+}
+
+type ClientEvent string
+
+const (
+	EStatusChanged ClientEvent = "status_changed"
+	EPrediction                = "prediction"
+	ERevision                  = "revision"
+	EOverrun                   = "overrun"
+	EError                     = "error"
+	ESpeech                    = "speech" //not sent on /v1/ws
+)
+
+type EventPayload struct {
+	Event   ClientEvent `json:"event"`
+	Result  interface{} `json:"result,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Key     string      `json:"key,omitempty"`
+	Code    string      `json:"code,omitempty"`
+}
+
+type Revision struct {
+	Segments []uint `json:"segments"`
+	Text     string `json:"text"`
+}
+
+// Speech locates a segment of speech in the audio stream. It is sent once
+// the segment is complete, before its prediction.
+type Speech struct {
+	Segment uint    `json:"segment"`
+	Start   float64 `json:"start"` //seconds since the start of the stream
+	End     float64 `json:"end"`
+}
+
+type Overrun struct {
+	Bytes   int                  `json:"bytes"`
+	Seconds float64              `json:"seconds,omitempty"` //estimated duration of the lost audio, unknown (0) until some audio was transcoded
+	Policy  audio.OverflowPolicy `json:"policy"`
+}
+
+// segment is an entry of the revision window. Entries that were merged by a
+// revision keep all their segment indices, so that later revisions always
+// replace whole groups on the client side.
+type segment struct {
+	indices []uint
+	frames  []byte
+	text    string
+}
+
+var clientIDCounter uint64
+
+// SendEvent queues an event for the transport. It never blocks: clients that
+// can't keep up with their events are disconnected.
+func (s *Session) SendEvent(e EventPayload) {
+	e.Key = s.KeyLabel
+	select {
+	case <-s.ctx.Done():
+	case s.out <- e:
+	default:
+		s.End(EndSlowConsumer, "event queue full")
+	}
+}
+
+// Events returns the queue of events to deliver to the client.
+func (s *Session) Events() <-chan EventPayload {
+	return s.out
+}
+
+// FlushEvents returns the events still queued when the session ends, such as
+// the error explaining why it ended.
+func (s *Session) FlushEvents() (events []EventPayload) {
+	for {
+		select {
+		case e := <-s.out:
+			events = append(events, e)
+		default:
+			return
+		}
+	}
+}
+
+// watch ends the session when it exceeds its limits: max session duration, and
+// idle timeout. Background sessions read files, whose audio waits on the
+// interactive sessions in the recognizer queue: they don't time out.
+func (s *Session) watch() {
+	var maxDuration <-chan time.Time
+	limits := limitsFor(s.KeyLabel)
+	if limits.MaxSessionDuration > 0 && !s.background {
+		timer := time.NewTimer(limits.MaxSessionDuration)
+		defer timer.Stop()
+		maxDuration = timer.C
+	}
+	var idle <-chan time.Time
+	resetIdle := func() {}
+	if s.cfg.HTTP.IdleTimeout > 0 && !s.background {
+		timer := time.NewTimer(s.cfg.HTTP.IdleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+		resetIdle = func() {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(s.cfg.HTTP.IdleTimeout)
+		}
+	}
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-maxDuration:
+			s.fail(&QuotaError{
+				Code:    ErrCodeSessionDuration,
+				Message: fmt.Sprintf("session duration exceeded (%v)", limits.MaxSessionDuration),
+			})
+		case <-s.audioSeen:
+			resetIdle()
+		case <-idle:
+			select {
+			case <-asrReady:
+				s.End(EndIdle, fmt.Sprintf("no audio received for %v", s.cfg.HTTP.IdleTimeout))
+			default:
+				//clients can't send audio during warmup
+				resetIdle()
+			}
+		}
+	}
+}
+
+// fail sends an error event to the client, and ends the session.
+func (s *Session) fail(err error) {
+	code, reason := ErrCodePredictionFailure, EndError
+	if qerr, ok := err.(*QuotaError); ok {
+		code, reason = qerr.Code, EndPolicy
+	}
+	s.SendEvent(EventPayload{
+		Event:   EError,
+		Result:  false,
+		Message: err.Error(),
+		Code:    code,
+	})
+	s.End(reason, err.Error())
+}
+
+// End ends the session, and records why for the transport. Only the first reason is kept.
+func (s *Session) End(reason EndReason, message string) {
+	s.setEndReason(reason, message)
+	s.cancel()
+}
+
+func (s *Session) setEndReason(reason EndReason, message string) {
+	s.endEx.Lock()
+	if !s.ended {
+		s.log.WithField("reason", reason).Infof("Ending session: %v", message)
+		s.endReason, s.endMsg, s.ended = reason, message, true
+	}
+	s.endEx.Unlock()
+}
+
+// EndReason tells why the session ended. Sessions that ended without an
+// explicit reason ended normally.
+func (s *Session) EndReason() (EndReason, string) {
+	s.endEx.Lock()
+	defer s.endEx.Unlock()
+	return s.endReason, s.endMsg
+}
+
+// SessionOptions describe the client of a session.
+type SessionOptions struct {
+	Transport string
+	Remote    string
+	KeyLabel  string
+	Overflow  audio.OverflowPolicy //overrides input.overflow, e.g. to block when the whole input is at hand
+
+	// Background sessions transcribe files nobody is waiting for live: the
+	// recognizer serves their segments after those of interactive sessions.
+	Background bool
+}
+
+// NewSession starts the audio pipeline of a client. The session ends with ctx.
+func NewSession(ctx context.Context, opts SessionOptions) (s *Session) {
+	counter := 1 + atomic.AddUint64(&clientIDCounter, 1)
+	cfg := Config()
+	keyLabel := opts.KeyLabel
+	s = &Session{
+		cfg:        cfg,
+		background: opts.Background,
+		GUID:       fmt.Sprintf("%08X", counter),
+		KeyLabel:   keyLabel,
+		Transport:  opts.Transport,
+		Remote:     opts.Remote,
+		Connected:  time.Now(),
+		out:        make(chan EventPayload, cfg.HTTP.SendQueue),
+		audioSeen:  make(chan struct{}, 1),
+		runDone:    make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.log = log.WithField("guid", s.GUID)
+	if keyLabel != "" {
+		s.log = s.log.WithField("key", keyLabel)
+	}
+	s.log.WithField("remote", s.Remote).WithField("transport", s.Transport).Println("Created new client")
+
+	overflow := s.cfg.Input.Overflow
+	if opts.Overflow != "" {
+		overflow = opts.Overflow
+	}
+	s.Audio.In = audio.NewInputBuffer(s.cfg.Input.BufferSize, overflow)
+	const sampleRate = 16000
+	s.Audio.In.OnOverflow = func(lost int) {
+		metricInputOverrun.Add(float64(lost))
+		seconds := s.inputSeconds(lost, sampleRate*2)
+		s.log.WithField("bytes", lost).WithField("seconds", seconds).Warn("Audio input buffer overrun")
+		s.SendEvent(EventPayload{
+			Event:  EOverrun,
+			Result: Overrun{Bytes: lost, Seconds: seconds, Policy: overflow},
+		})
+	}
+	transcoder := audio.Transcode(s.ctx, s.Audio.In, audio.WAV, sampleRate)
+	s.Audio.Activity = make(chan audio.Activity, 1)
+	s.Audio.InfoC = make(chan audio.WAVEInfo, 1)
+
+	s.wg.Add(3)
+	go func() {
+		defer s.wg.Done()
+		s.watch()
+	}()
+	go func() {
+		defer s.wg.Done()
+		defer close(s.Audio.Activity)
+		defer close(s.Audio.InfoC)
+		pcm := countingReader{AudioReader: transcoder, bytesPerSecond: sampleRate * 2, n: &s.pcmBytes} //mono, 16 bits per sample
+		err := audio.ScanActivity(s.ctx, pcm, s.Audio.InfoC, s.Audio.Activity, s.cfg.Activity)
+		s.Audio.In.Close()
+		if werr := transcoder.Close(); err == nil && s.ctx.Err() == nil {
+			err = werr
+		}
+		s.log.WithError(err).Println("Exited scan goroutine")
+	}()
+	go func() {
+		defer s.wg.Done()
+		defer s.cancel()
+		defer close(s.runDone)
+		err := s.run()
+		if err != nil && s.ctx.Err() == nil {
+			s.fail(err)
+		}
+		s.log.WithError(err).Println("Exited run goroutine")
+	}()
+
+	select {
+	case <-asrReady:
+		s.SendEvent(EventPayload{
+			Event:   EStatusChanged,
+			Result:  true,
+			Message: "ASR ready",
+		})
+	default:
+		s.SendEvent(EventPayload{
+			Event:   EStatusChanged,
+			Result:  false,
+			Message: "ASR still warming up",
+		})
+	}
+	return
+}
+
+// inputSeconds estimates the duration of lost bytes of input audio, from the
+// ratio of transcoded audio to input bytes consumed by the transcoder so far.
+// The input is usually compressed: the estimate is only as good as the
+// bitrate is constant. It is 0 until some audio was transcoded.
+func (s *Session) inputSeconds(lost int, pcmBytesPerSecond float64) float64 {
+	consumed := atomic.LoadInt64(&s.bytesIn) - atomic.AddInt64(&s.bytesLost, int64(lost)) - int64(s.Audio.In.Buffered())
+	pcm := atomic.LoadInt64(&s.pcmBytes)
+	if consumed <= 0 || pcm == 0 {
+		return 0
+	}
+	seconds := float64(lost) * float64(pcm) / pcmBytesPerSecond / float64(consumed)
+	return math.Round(seconds*1000) / 1000
+}
+
+// Info returns a snapshot of the client session.
+func (s *Session) Info() ClientInfo {
+	return ClientInfo{
+		GUID:      s.GUID,
+		Key:       s.KeyLabel,
+		Transport: s.Transport,
+		Remote:    s.Remote,
+		Connected: s.Connected,
+		BytesIn:   atomic.LoadInt64(&s.bytesIn),
+		Segments:  atomic.LoadInt64(&s.segments),
+		Pending:   atomic.LoadInt64(&s.pending),
+	}
+}
+
+// Done returns a channel that is closed once the client session is over.
+func (s *Session) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Close cancels the client session, and waits until its audio pipeline
+// (transcoder process, activity scanner and predictions) is torn down.
+// Once Close returns, the session no longer owns any goroutine or process.
+func (s *Session) Close() error {
+	s.cancel()
+	s.Audio.In.Close()
+	s.wg.Wait()
+	return nil
+}
+
+// CloseInput tells the session that the client won't send more audio. The
+// session ends normally once the audio already received is transcribed.
+func (s *Session) CloseInput() {
+	s.Audio.In.Close()
+}
+
+// Drain stops accepting audio from the client, and waits until the audio
+// already received is transcribed, or ctx is done. The session then ends
+// with EndShutdown.
+func (s *Session) Drain(ctx context.Context) {
+	const reason = "server shutting down"
+	s.setEndReason(EndShutdown, reason)
+	s.Audio.In.Close()
+	select {
+	case <-s.runDone:
+	case <-ctx.Done():
+		s.log.Warn("Drain timed out, dropping pending segments")
+	}
+	s.End(EndShutdown, reason)
+}
+
+// Write feeds audio received from the client to the pipeline. Audio sent
+// during the warmup is dropped, and answered with an error event.
+func (s *Session) Write(data []byte) (err error) {
+	s.log.WithField("bytes", len(data)).Trace("Recv audio")
+	select {
+	case <-asrReady:
+		select {
+		case s.audioSeen <- struct{}{}:
+		default:
+		}
+		metricInputReceived.Add(float64(len(data)))
+		atomic.AddInt64(&s.bytesIn, int64(len(data)))
+		if _, err := s.Audio.In.Write(data); err != nil && err != audio.ErrOverflow { //shadowing intentional, dont care.
+			s.log.Warnf("Failed to buffer audio: %v", err) //shortWrite
+		}
+		return
+	default:
+		s.SendEvent(EventPayload{
+			Event:   EError,
+			Result:  false,
+			Message: "ASR still warming up",
+			Code:    ErrCodeASRNotReady,
+		})
+		return
+	}
+}
+
+func (s *Session) predict(name string, format audio.WAVEInfo, data []byte) (pred recognizer.Prediction, err error) {
+	atomic.AddInt64(&s.pending, 1)
+	defer atomic.AddInt64(&s.pending, -1)
+	seg := recognizer.Segment{Name: name, Format: format, Frames: data}
+	return asr.Recognize(s.ctx, seg, recognizer.Options{Session: s.GUID, Background: s.background})
+}
+
+// trimWindow drops the oldest entries of the window, so that it holds at most
+// maxSegments segment indices, and maxDuration of audio (when positive).
+// Merged entries count as all their segments: otherwise, revisions would
+// keep merging into ever longer inputs.
+func trimWindow(window []segment, format audio.WAVEInfo, maxSegments int, maxDuration time.Duration) []segment {
+	var count, size int
+	for i := len(window) - 1; i >= 0; i-- {
+		count += len(window[i].indices)
+		size += len(window[i].frames)
+		if count > maxSegments || maxDuration > 0 && format.Duration(size) > maxDuration {
+			return window[i+1:]
+		}
+	}
+	return window
+}
+
+// revise re-decodes the most recent segments of the window as a single input,
+// and notifies the client whenever it disagrees with the previous predictions.
+func (s *Session) revise(window []segment, format audio.WAVEInfo) ([]segment, error) {
+	window = trimWindow(window, format, s.cfg.Revision.Window, s.cfg.Revision.MaxDuration)
+	if len(window) < 2 {
+		return window, nil
+	}
+
+	var (
+		merged  segment
+		current []string
+	)
+	for _, seg := range window {
+		merged.indices = append(merged.indices, seg.indices...)
+		merged.frames = append(merged.frames, seg.frames...)
+		if seg.text != "" {
+			current = append(current, seg.text)
+		}
+	}
+	first, last := merged.indices[0], merged.indices[len(merged.indices)-1]
+	pred, err := s.predict(fmt.Sprintf("%v_%04x-%04x", s.GUID, first, last), format, merged.frames)
+	if err != nil {
+		return window, err
+	}
+	merged.text = pred.Text
+	if normalizeText(merged.text) == normalizeText(strings.Join(current, " ")) {
+		return window, nil
+	}
+
+	s.log.Debugf("revised segments %v..%v: %v", first, last, merged.text)
+	s.SendEvent(EventPayload{
+		Event: ERevision,
+		Result: Revision{
+			Segments: merged.indices,
+			Text:     merged.text,
+		},
+	})
+	return []segment{merged}, nil
+}
+
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+func (s *Session) run() (err error) {
+	defer s.log.Print("client runner exited")
+	ctx := s.ctx
+
+	var counter uint
+	var format audio.WAVEInfo
+	var window []segment
+	var ok bool
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case format, ok = <-s.Audio.InfoC:
+		if !ok {
+			return errors.New("failed to read audio format")
+		}
+	}
+
+	s.log.Debugf("ASR input audio format: %+v", format)
+	for {
+		var prediction recognizer.Prediction
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-s.Audio.Activity:
+			if !ok {
+				return
+			}
+			index := counter
+			counter++
+			slog := s.log.WithField("segment", index)
+			slog.Debugf("audio activity: start=%v duration=%v gain=~%v", event.Start, event.Duration, event.Mean)
+			if err = chargeAudio(s.KeyLabel, format.Duration(len(event.Frames))); err != nil {
+				return
+			}
+			s.SendEvent(EventPayload{
+				Event: ESpeech,
+				Result: Speech{
+					Segment: index,
+					Start:   event.Start.Seconds(),
+					End:     (event.Start + event.Duration).Seconds(),
+				},
+			})
+			if prediction, err = s.predict(fmt.Sprintf("%v_%04x", s.GUID, index), format, event.Frames); err != nil {
+				return
+			}
+			prediction.Segment = index
+			slog.WithField("runner", prediction.Runner).
+				WithField("decode", prediction.Decode).
+				Debugf("got prediction: %v", prediction.Text)
+			metricSegments.Inc()
+			atomic.AddInt64(&s.segments, 1)
+			if strings.TrimSpace(prediction.Text) == "" {
+				metricSegmentsEmpty.Inc()
+			}
+			if d := format.Duration(len(event.Frames)); d > 0 {
+				metricASRRealTimeFactor.Observe(prediction.Decode.Seconds() / d.Seconds())
+			}
+			s.SendEvent(EventPayload{
+				Event:  EPrediction,
+				Result: prediction,
+			})
+
+			if s.cfg.Revision.Window < 2 {
+				continue
+			}
+			window = append(window, segment{
+				indices: []uint{index},
+				frames:  append([]byte(nil), event.Frames...), //frames are owned by the scanner's ring buffers
+				text:    prediction.Text,
+			})
+			if window, err = s.revise(window, format); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/cowdude/flapi/src/audio"
+)
+
+func TestTrimWindow(t *testing.T) {
+	format, _, err := audio.ReadWAV(bytes.NewReader(testAudio()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := make([]byte, 32000)
+	window := []segment{
+		{indices: []uint{1, 2, 3}, frames: second},
+		{indices: []uint{4}, frames: second},
+		{indices: []uint{5}, frames: second},
+	}
+	for _, tt := range []struct {
+		maxSegments int
+		maxDuration time.Duration
+		first       uint
+	}{
+		{maxSegments: 5, first: 1},
+		{maxSegments: 4, first: 4},
+		{maxSegments: 2, first: 4},
+		{maxSegments: 1, first: 5},
+		{maxSegments: 5, maxDuration: 2 * time.Second, first: 4},
+		{maxSegments: 5, maxDuration: 10 * time.Second, first: 1},
+	} {
+		trimmed := trimWindow(window, format, tt.maxSegments, tt.maxDuration)
+		if len(trimmed) == 0 || trimmed[0].indices[0] != tt.first {
+			t.Errorf("window of %d segments, %v: got %+v, want it to start at %d",
+				tt.maxSegments, tt.maxDuration, trimmed, tt.first)
+		}
+	}
+}
+
+// Revisions disagree with the predictions of the fake, which predicts the same
+// text for all inputs: every segment triggers a revision of the window.
+func TestRevisionWindowBounded(t *testing.T) {
+	withConfig(t, func(cfg *Configuration) {
+		cfg.Revision.Window = 3
+		cfg.Revision.MaxDuration = 0
+	})
+	s := NewSession(context.Background(), SessionOptions{Transport: "test", Overflow: audio.Block})
+	defer s.Close()
+
+	var spans []time.Duration
+	for i := 0; i < 6; i++ {
+		spans = append(spans, time.Second, time.Second)
+	}
+	var revisions int
+	_, err := collectTranscript(s, bytes.NewReader(testAudio(spans...)), func(e EventPayload) {
+		if e.Event != ERevision {
+			return
+		}
+		revisions++
+		if segments := e.Result.(Revision).Segments; len(segments) > 3 {
+			t.Errorf("revision of %d segments: %v", len(segments), segments)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revisions < 3 {
+		t.Errorf("expected a revision for most segments, got %d", revisions)
+	}
+}
+
+// Sessions cancelled mid-stream must not leak their transcoder process, nor
+// any goroutine.
+func TestSessionCloseMidStream(t *testing.T) {
+	before := runtime.NumGoroutine()
+	s := NewSession(context.Background(), SessionOptions{Transport: "test", Overflow: audio.Block})
+
+	//the first utterance and a part of the second one, without closing the input
+	in := testAudio(time.Second, time.Second, time.Second, time.Second)
+	s.Write(append([]byte(nil), in[:len(in)*5/8]...))
+	if audio.RunningProcesses() == 0 {
+		t.Error("no transcoder process running")
+	}
+	timeout := time.After(5 * time.Second)
+	for prediction := false; !prediction; {
+		select {
+		case e := <-s.Events():
+			prediction = e.Event == EPrediction
+		case <-timeout:
+			t.Fatal("no prediction for the first utterance")
+		}
+	}
+
+	s.Close()
+	if n := audio.RunningProcesses(); n != 0 {
+		t.Errorf("%d transcoder process(es) still running", n)
+	}
+	//goroutines of the session may still be returning from their deferred calls
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		after := runtime.NumGoroutine()
+		if after <= before {
+			break
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines before the session, %d after:\n%s", before, after, buf[:runtime.Stack(buf, true)])
+		}
+	}
+}
+
+func TestOverrunSeconds(t *testing.T) {
+	s := &Session{bytesIn: 100000, pcmBytes: 320000} //10s of PCM, transcoded from 80kB of input
+	s.Audio.In = audio.NewInputBuffer(1<<20, audio.DropOldest)
+	s.Audio.In.Write(make([]byte, 12000))
+	if seconds := s.inputSeconds(8000, 32000); seconds != 1 {
+		t.Errorf("8kB lost at 8kB/s: estimated %vs", seconds)
+	}
+	if seconds := (&Session{bytesIn: 100, Audio: s.Audio}).inputSeconds(100, 32000); seconds != 0 {
+		t.Errorf("estimated %vs before any transcoding", seconds)
+	}
+}
+
+// slowReader waits before each read, like a file whose audio waits on the
+// interactive sessions.
+type slowReader struct {
+	r     *bytes.Reader
+	delay time.Duration
+}
+
+func (r slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	if len(p) > 16000 {
+		p = p[:16000]
+	}
+	return r.r.Read(p)
+}
+
+func TestBackgroundSessionNoIdleTimeout(t *testing.T) {
+	withConfig(t, func(cfg *Configuration) { cfg.HTTP.IdleTimeout = 50 * time.Millisecond })
+	for _, background := range []bool{false, true} {
+		s := NewSession(context.Background(), SessionOptions{Transport: "test", Overflow: audio.Block, Background: background})
+		r := slowReader{bytes.NewReader(testAudio(time.Second, time.Second)), 100 * time.Millisecond}
+		_, err := collectTranscript(s, r, nil)
+		s.Close()
+		if reason, _ := s.EndReason(); background && err != nil {
+			t.Errorf("background session ended (%v): %v", reason, err)
+		} else if !background && reason != EndIdle {
+			t.Errorf("interactive session ended (%v), want idle: %v", reason, err)
+		}
+	}
+}
+
+func TestBackgroundSessionOutlivesMaxDuration(t *testing.T) {
+	withConfig(t, func(cfg *Configuration) { cfg.Auth.Limits.MaxSessionDuration = 100 * time.Millisecond })
+	for _, background := range []bool{false, true} {
+		s := NewSession(context.Background(), SessionOptions{Transport: "test", Overflow: audio.Block, Background: background})
+		r := slowReader{bytes.NewReader(testAudio(time.Second, time.Second)), 100 * time.Millisecond}
+		_, err := collectTranscript(s, r, nil)
+		s.Close()
+		if reason, _ := s.EndReason(); background && err != nil {
+			t.Errorf("background session ended (%v): %v", reason, err)
+		} else if !background && reason != EndPolicy {
+			t.Errorf("interactive session ended (%v), want policy: %v", reason, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	draining  int32
+	drainingC = make(chan struct{}) //closed when the server starts shutting down
+)
+
+func isDraining() bool { return atomic.LoadInt32(&draining) != 0 }
+
+// shutdown stops accepting connections, lets the connected clients finish their
+// pending segments within http.shutdown_timeout, then closes the sessions and
+// the gRPC server and the ASR process. Background sessions end right away.
+func shutdown(server *http.Server) {
+	log.WithField("timeout", Config().HTTP.ShutdownTimeout).Println("Shutting down")
+	atomic.StoreInt32(&draining, 1)
+	close(drainingC)
+	ctx, cancel := context.WithTimeout(context.Background(), Config().HTTP.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warnf("http shutdown: %v", err)
+	}
+	if grpcServer != nil {
+		//returns once the streams of the drained sessions are over
+		go grpcServer.GracefulStop()
+	}
+	DispatchEvent(EventPayload{
+		Event:   EStatusChanged,
+		Result:  false,
+		Message: "server shutting down",
+	})
+
+	var wg sync.WaitGroup
+	sessionsEx.Lock()
+	for _, session := range sessions {
+		if session.background {
+			//watched files and jobs start over after the restart: don't wait for them
+			session.End(EndShutdown, "server shutting down")
+			continue
+		}
+		wg.Add(1)
+		go func(session *Session) {
+			defer wg.Done()
+			session.Drain(ctx)
+		}(session)
+	}
+	sessionsEx.Unlock()
+	wg.Wait()
+
+	//sessions still waiting for a prediction are released by closing the ASR
+	if err := asr.Close(); err != nil {
+		log.Errorf("failed to close ASR: %v", err)
+	}
+	for deadline := time.Now().Add(time.Second * 5); time.Now().Before(deadline); {
+		sessionsEx.Lock()
+		n := len(sessions)
+		sessionsEx.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	if grpcServer != nil {
+		grpcServer.Stop()
+	}
+	log.Println("Shutdown complete")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cowdude/flapi/src/audio"
+)
+
+// Draining sessions transcribe the audio they already received, including an
+// utterance cut short by the end of the input.
+func TestDrainFlushesLastUtterance(t *testing.T) {
+	s := NewSession(context.Background(), SessionOptions{Transport: "test", Overflow: audio.Block})
+	defer s.Close()
+
+	s.Write(testAudio(time.Second, time.Second, time.Second)) //no silence after the second utterance
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.Drain(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("drain timed out")
+	}
+
+	var predictions int
+	for _, e := range s.FlushEvents() {
+		if e.Event == EPrediction {
+			predictions++
+		}
+	}
+	if predictions != 2 {
+		t.Errorf("expected 2 predictions, got %d", predictions)
+	}
+	if reason, _ := s.EndReason(); reason != EndShutdown {
+		t.Errorf("session ended with %v", reason)
+	}
+}
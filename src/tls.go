@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// certCheckInterval throttles how often certificate files are checked for changes.
+const certCheckInterval = 5 * time.Second
+
+// certReloader serves the server certificate and the client CA pool, and
+// reloads them whenever their files change on disk, so that renewed
+// certificates are picked up without restarting the service.
+type certReloader struct {
+	certFile, keyFile, caFile string
+
+	mu      sync.Mutex
+	base    *tls.Config
+	current *tls.Config
+	modTime time.Time
+	checked time.Time
+}
+
+// newTLSConfig returns the TLS config of a server negotiating nextProtos
+// (ALPN). They are set on the configs served per client too, which replace
+// the returned one for the handshake.
+func newTLSConfig(nextProtos ...string) (*tls.Config, error) {
+	opts := Config().HTTP.TLS
+	if opts.Cert == "" || opts.Key == "" {
+		return nil, errors.New("http.tls requires both cert and key")
+	}
+	reloader := &certReloader{
+		certFile: opts.Cert,
+		keyFile:  opts.Key,
+		caFile:   opts.ClientCA,
+		base: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			NextProtos: nextProtos,
+		},
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		NextProtos:         nextProtos,
+		GetConfigForClient: reloader.getConfigForClient,
+	}, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+// lastModified returns the most recent modification time of the TLS files.
+func (r *certReloader) lastModified() (latest time.Time, err error) {
+	for _, name := range r.files() {
+		var st os.FileInfo
+		if st, err = os.Stat(name); err != nil {
+			return
+		}
+		if st.ModTime().After(latest) {
+			latest = st.ModTime()
+		}
+	}
+	return
+}
+
+func (r *certReloader) reload() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	cfg := r.base.Clone()
+	cfg.Certificates = []tls.Certificate{cert}
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		cfg.ClientCAs = x509.NewCertPool()
+		if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %v", r.caFile)
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	r.current, r.modTime = cfg, modTime
+	return nil
+}
+
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := time.Now(); now.Sub(r.checked) >= certCheckInterval {
+		r.checked = now
+		if modTime, err := r.lastModified(); err != nil {
+			log.Warnf("Failed to check TLS files: %v", err)
+		} else if modTime.After(r.modTime) {
+			if err = r.reload(); err != nil {
+				log.Errorf("Failed to reload TLS files, keeping previous certificates: %v", err)
+			} else {
+				log.Println("Reloaded TLS certificates")
+			}
+		}
+	}
+	return r.current, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cowdude/flapi/src/client"
+	"github.com/cowdude/flapi/src/flapipb"
+	"github.com/cowdude/flapi/src/recognizer"
+)
+
+// Transcript assembles the events of a session into transcribed segments,
+// applying revisions. It is the transcript of the Go client, fed with the
+// events of the session rather than with the events of the protocol.
+type Transcript struct {
+	client.Transcript
+}
+
+// Apply updates the transcript with an event. Other events than speech,
+// predictions and revisions are ignored.
+func (t *Transcript) Apply(e EventPayload) {
+	switch e.Event {
+	case ESpeech:
+		speech := e.Result.(Speech)
+		t.Transcript.Apply(&client.Speech{Segment: speech.Segment, Start: speech.Start, End: speech.End})
+	case EPrediction:
+		pred := e.Result.(recognizer.Prediction)
+		t.Transcript.Apply(&client.Prediction{Segment: pred.Segment, Text: pred.Text})
+	case ERevision:
+		rev := e.Result.(Revision)
+		t.Transcript.Apply(&client.Revision{Segments: rev.Segments, Text: rev.Text})
+	}
+}
+
+// Proto returns the transcript as a response of the gRPC RecognizeFile call.
+func (t *Transcript) Proto() *flapipb.RecognizeFileResponse {
+	res := &flapipb.RecognizeFileResponse{Text: t.Text()}
+	for _, seg := range t.Segments {
+		indices := make([]uint32, len(seg.Indices))
+		for i, index := range seg.Indices {
+			indices[i] = uint32(index)
+		}
+		res.Segments = append(res.Segments, &flapipb.TranscriptSegment{
+			Indices: indices,
+			Start:   seg.Start,
+			End:     seg.End,
+			Text:    seg.Text,
+		})
+	}
+	return res
+}
+
+// transcriptWriters are the transcript file formats, by file extension.
+var transcriptWriters = client.Writers
+
+// SessionError reports a session that did not end normally.
+type SessionError struct {
+	Reason  EndReason
+	Message string
+}
+
+func (e *SessionError) Error() string {
+	return fmt.Sprintf("session ended (%v): %v", e.Reason, e.Message)
+}
+
+// collectTranscript feeds the whole audio of r to a session, and returns its
+// transcript once the session ends. The session should block rather than
+// drop audio. onEvent, when set, is called with every event of the session.
+// Sessions that don't end normally return a *SessionError.
+func collectTranscript(s *Session, r io.Reader, onEvent func(EventPayload)) (*Transcript, error) {
+	fed := make(chan error, 1)
+	go func() {
+		defer s.CloseInput()
+		const chunkSize = 64 << 10
+		for s.ctx.Err() == nil {
+			chunk := make([]byte, chunkSize) //owned by the input buffer once written
+			n, err := r.Read(chunk)
+			if n > 0 {
+				s.Write(chunk[:n])
+			}
+			if err == io.EOF {
+				err = nil
+				break
+			} else if err != nil {
+				s.End(EndError, fmt.Sprintf("reading audio: %v", err))
+				fed <- err
+				return
+			}
+		}
+		fed <- nil
+	}()
+
+	var t Transcript
+	apply := func(e EventPayload) {
+		t.Apply(e)
+		if onEvent != nil {
+			onEvent(e)
+		}
+	}
+	for {
+		select {
+		case e := <-s.Events():
+			apply(e)
+		case <-s.Done():
+			for _, e := range s.FlushEvents() {
+				apply(e)
+			}
+			<-fed
+			if reason, message := s.EndReason(); reason != EndNormal {
+				return nil, &SessionError{Reason: reason, Message: message}
+			}
+			return &t, nil
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cowdude/flapi/src/audio"
+)
+
+func TestCollectTranscript(t *testing.T) {
+	s := NewSession(context.Background(), SessionOptions{Transport: "test", Overflow: audio.Block})
+	defer s.Close()
+
+	in := testAudio(time.Second, time.Second, time.Second, time.Second)
+	transcript, err := collectTranscript(s, bytes.NewReader(in), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcript.Segments) != 2 {
+		t.Fatalf("expected 2 segments, got %+v", transcript.Segments)
+	}
+	for i, seg := range transcript.Segments {
+		if seg.Text != testPrediction || seg.End <= seg.Start {
+			t.Errorf("segment %d: unexpected %+v", i, seg)
+		}
+	}
+	if start := transcript.Segments[1].Start; start < 1.5 || start > 2.5 {
+		t.Errorf("second segment starts at %vs, expected about 2s", start)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cowdude/flapi/src/audio"
+	log "github.com/sirupsen/logrus"
+)
+
+// Subfolders of the watched directories, where processed files are moved.
+const (
+	watchDone  = "done"
+	watchError = "error"
+)
+
+// watchKeyLabel is the key label of the watch sessions, whose quotas are set by
+// watch.limits rather than auth.limits. API keys can't use it.
+const watchKeyLabel = "watch"
+
+// watchedFile is a file of a watched directory, waiting for its size and
+// modification time to settle.
+type watchedFile struct {
+	size  int64
+	mtime time.Time
+	since time.Time //when size and mtime were last seen changing
+}
+
+// watchFolders transcribes the audio files dropped in the watch.dirs, until
+// ctx is done. Directories are polled rather than watched with inotify, which
+// misses the files written to network shares by other hosts. A file is picked
+// up once it stopped growing for watch.settle, transcribed through a session
+// like any client stream, then moved to the done/ or error/ subfolder.
+func watchFolders(ctx context.Context) {
+	cfg := Config().Watch
+	if len(cfg.Dirs) == 0 {
+		return
+	}
+	for _, dir := range cfg.Dirs {
+		for _, sub := range []string{watchDone, watchError} {
+			if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+				log.WithError(err).Errorf("Watch folders disabled")
+				return
+			}
+		}
+	}
+	select {
+	case <-asrReady:
+	case <-ctx.Done():
+		return
+	}
+	log.WithField("dirs", cfg.Dirs).Println("Watching folders for audio files")
+
+	queue := make(chan string)
+	finished := make(chan string, cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range queue {
+				processWatched(cfg.Output, cfg.Formats, path)
+				finished <- path
+			}
+		}()
+	}
+	defer func() {
+		close(queue)
+		wg.Wait()
+	}()
+
+	pending := make(map[string]*watchedFile)
+	inFlight := make(map[string]bool)
+	ticker := time.NewTicker(cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		seen := make(map[string]bool)
+		for _, dir := range cfg.Dirs {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				log.WithError(err).WithField("dir", dir).Warn("Failed to scan watched folder")
+				continue
+			}
+			for _, entry := range entries {
+				name := entry.Name()
+				if entry.IsDir() || strings.HasPrefix(name, ".") || !hasExtension(name, cfg.Extensions) {
+					continue
+				}
+				path := filepath.Join(dir, name)
+				seen[path] = true
+				info, err := entry.Info()
+				if err != nil || inFlight[path] {
+					continue
+				}
+				f, ok := pending[path]
+				if !ok || f.size != info.Size() || !f.mtime.Equal(info.ModTime()) {
+					pending[path] = &watchedFile{size: info.Size(), mtime: info.ModTime(), since: now}
+					continue
+				}
+				if now.Sub(f.since) < cfg.Settle || isDraining() {
+					continue
+				}
+				select {
+				case queue <- path: //otherwise, all the workers are busy: retry on the next scan
+					delete(pending, path)
+					inFlight[path] = true
+				default:
+				}
+			}
+		}
+		for path := range pending {
+			if !seen[path] {
+				delete(pending, path) //removed before it settled
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case path := <-finished:
+			delete(inFlight, path)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func hasExtension(name string, exts []string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	for _, e := range exts {
+		if ext == strings.ToLower(e) {
+			return true
+		}
+	}
+	return false
+}
+
+// processWatched transcribes a file of a watched directory, and writes its
+// transcript files to output (the done/ subfolder when empty). The file is
+// then moved to done/, or to error/ along with an error report. Files
+// interrupted by a shutdown are left in place, to be transcribed again on
+// the next start. Files of an earlier name get a counter suffix in done/ and
+// error/, and so do their transcripts.
+func processWatched(output string, formats []string, path string) {
+	dir, name := filepath.Split(path)
+	if output == "" {
+		output = filepath.Join(dir, watchDone)
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	logger := log.WithField("path", path)
+	logger.Println("Transcribing watched file")
+	start := time.Now()
+
+	err := func() error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		//the whole file is at hand: block instead of dropping audio
+		s := NewSession(context.Background(), SessionOptions{
+			Transport:  "watch",
+			Remote:     path,
+			KeyLabel:   watchKeyLabel,
+			Overflow:   audio.Block,
+			Background: true,
+		})
+		registerSession(s)
+		defer unregisterSession(s)
+		defer s.Close()
+
+		transcript, err := collectTranscript(s, f, nil)
+		if err != nil {
+			return err
+		}
+		base = freeBase(base, func(base string) []string {
+			paths := []string{filepath.Join(dir, watchDone, base+ext)}
+			for _, format := range formats {
+				paths = append(paths, filepath.Join(output, base+"."+format))
+			}
+			return paths
+		})
+		for _, format := range formats {
+			write := transcriptWriters[format]
+			err = writeFileAtomic(filepath.Join(output, base+"."+format), func(w *os.File) error {
+				return write(&transcript.Transcript, w)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+
+	var serr *SessionError
+	if err != nil && (errors.As(err, &serr) && serr.Reason == EndShutdown || isDraining()) {
+		logger.Warn("Transcription interrupted by shutdown, leaving the file in place")
+		return
+	}
+	if err == nil {
+		if err = os.Rename(path, filepath.Join(dir, watchDone, base+ext)); err == nil {
+			metricWatchFiles.WithLabelValues("done").Inc()
+			logger.WithField("duration", time.Since(start).Round(time.Millisecond)).Println("Watched file transcribed")
+			return
+		}
+	}
+
+	metricWatchFiles.WithLabelValues("error").Inc()
+	logger.WithError(err).Error("Watched file failed")
+	base = freeBase(strings.TrimSuffix(name, ext), func(base string) []string {
+		return []string{filepath.Join(dir, watchError, base+ext), filepath.Join(dir, watchError, base+ext+".error.txt")}
+	})
+	if rerr := os.Rename(path, filepath.Join(dir, watchError, base+ext)); rerr != nil {
+		logger.WithError(rerr).Error("Failed to move the file to error/")
+	}
+	report := fmt.Sprintf("file: %v\nfailed_at: %v\nerror: %v\n", path, time.Now().UTC().Format(time.RFC3339), err)
+	err = writeFileAtomic(filepath.Join(dir, watchError, base+ext+".error.txt"), func(w *os.File) error {
+		_, err := w.WriteString(report)
+		return err
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to write the error report")
+	}
+}
+
+// freeBase returns base, or base followed by a counter ("call-2"), such that
+// none of the paths of the name exists yet.
+func freeBase(base string, paths func(base string) []string) string {
+	candidate := base
+	for n := 2; ; n++ {
+		free := true
+		for _, path := range paths(candidate) {
+			if _, err := os.Lstat(path); !os.IsNotExist(err) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%v-%d", base, n)
+	}
+}
+
+// writeFileAtomic writes a file under a temporary name first, so that readers
+// of the directory never see partial files.
+func writeFileAtomic(path string, write func(*os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	err = write(tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newWatchDir returns a new watched directory, with its subfolders.
+func newWatchDir(t *testing.T) string {
+	dir := t.TempDir()
+	for _, sub := range []string{watchDone, watchError} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// dropWatched drops call.wav in a watched directory, and processes it.
+func dropWatched(t *testing.T, dir string) {
+	path := filepath.Join(dir, "call.wav")
+	if err := os.WriteFile(path, testAudio(time.Second, time.Second), 0644); err != nil {
+		t.Fatal(err)
+	}
+	processWatched("", []string{"txt"}, path)
+}
+
+// watchTestFile drops a file in a new watched directory, and processes it.
+func watchTestFile(t *testing.T) (dir string) {
+	dir = newWatchDir(t)
+	dropWatched(t, dir)
+	return dir
+}
+
+func TestWatchLimits(t *testing.T) {
+	//the anonymous quota doesn't apply to watch folders
+	withConfig(t, func(cfg *Configuration) { cfg.Auth.Limits.AudioPerMinute = time.Millisecond })
+	dir := watchTestFile(t)
+	text, err := os.ReadFile(filepath.Join(dir, watchDone, "call.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(text)) != testPrediction {
+		t.Errorf("transcript %q", text)
+	}
+
+	withConfig(t, func(cfg *Configuration) { cfg.Watch.Limits.AudioPerMinute = time.Millisecond })
+	dir = watchTestFile(t)
+	report, err := os.ReadFile(filepath.Join(dir, watchError, "call.wav.error.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(report), "audio quota exceeded") {
+		t.Errorf("unexpected error report %q", report)
+	}
+}
+
+func TestWatchSameName(t *testing.T) {
+	dir := newWatchDir(t)
+	for i := 0; i < 3; i++ {
+		dropWatched(t, dir)
+	}
+	for _, name := range []string{"call.wav", "call.txt", "call-2.wav", "call-2.txt", "call-3.wav", "call-3.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, watchDone, name)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	withConfig(t, func(cfg *Configuration) { cfg.Watch.Limits.AudioPerMinute = time.Millisecond })
+	for i := 0; i < 2; i++ {
+		dropWatched(t, dir)
+	}
+	for _, name := range []string{"call.wav", "call.wav.error.txt", "call-2.wav", "call-2.wav.error.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, watchError, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"net/http"
-	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -11,52 +11,98 @@ import (
 
 var (
 	upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
+		CheckOrigin: checkOrigin,
 	}
-	clients   = make(map[string]*Client)
-	clientsEx sync.Mutex
 )
 
-func DispatchEvent(payload EventPayload) {
-	clientsEx.Lock()
-	for _, client := range clients {
-		client.SendEvent(payload)
+// Application-specific websocket close codes.
+const (
+	CloseIdleTimeout  = 4000 // no audio was received for http.idle_timeout
+	CloseSlowConsumer = 4001 // the client doesn't read its events fast enough
+)
+
+// acceptWS authenticates a websocket request and upgrades it. It answers the
+// request itself when the connection is refused.
+func acceptWS(w http.ResponseWriter, r *http.Request) (c *websocket.Conn, label string, ok bool) {
+	if isDraining() {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	label, err := authenticate(r)
+	if err != nil {
+		log.WithField("remote", r.RemoteAddr).Warnf("auth: %v", err)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if c, err = upgrader.Upgrade(w, r, nil); err != nil {
+		log.Warn("upgrade:", err)
+		return
 	}
-	clientsEx.Unlock()
+	return c, label, true
 }
 
 func handleWS(w http.ResponseWriter, r *http.Request) {
-	c, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Warn("upgrade:", err)
+	c, label, ok := acceptWS(w, r)
+	if !ok {
 		return
 	}
 	defer c.Close()
 
-	client := NewClient(c, r)
-	clientsEx.Lock()
-	clients[client.GUID] = client
-	clientsEx.Unlock()
-	defer func() {
-		clientsEx.Lock()
-		delete(clients, client.GUID)
-		clientsEx.Unlock()
-	}()
+	var err error
+
+	if err = acquireSession(label); err != nil {
+		log.WithField("key", label).Warnf("session rejected: %v", err)
+		c.WriteJSON(EventPayload{
+			Event:   EError,
+			Result:  false,
+			Message: err.Error(),
+			Code:    err.(*QuotaError).Code,
+			Key:     label,
+		})
+		c.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()),
+			time.Now().Add(Config().HTTP.WriteTimeout))
+		return
+	}
+	defer releaseSession(label)
+
+	client := NewClient(c, r, label)
+	defer client.Close()
+	registerSession(client.Session)
+	defer unregisterSession(client.Session)
+
+	//pongs and messages extend the read deadline; a silent peer is dropped
+	//after missing a pong for http.pong_timeout.
+	extendDeadline := func() {
+		c.SetReadDeadline(time.Now().Add(client.cfg.HTTP.PingInterval + client.cfg.HTTP.PongTimeout))
+	}
+	extendDeadline()
+	c.SetReadLimit(client.cfg.HTTP.MaxMessageSize)
+	c.SetPongHandler(func(string) error {
+		extendDeadline()
+		return nil
+	})
 
 	for {
 		mt, data, err := c.ReadMessage()
 		if err != nil {
-			log.Warnf("read: %v", err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				client.log.Warnf("read: %v", err)
+			}
 			return
 		}
+		extendDeadline()
 		switch mt {
 		case websocket.BinaryMessage:
-			if err = client.handleBinary(data); err != nil {
-				log.Warnf("handle binary: %v", err)
+			if err = client.Write(data); err != nil {
+				client.log.Warnf("handle binary: %v", err)
+				client.End(EndError, err.Error())
 				return
 			}
 		default:
-			log.Warnf("unknown websocket message type: %v", mt)
+			client.log.Warnf("unknown websocket message type: %v", mt)
+			client.End(EndUnsupported, "only binary messages are supported")
 			return
 		}
 	}
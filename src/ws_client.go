@@ -1,166 +1,102 @@
 package main
 
 import (
-	"bytes"
-	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path"
-	"sync/atomic"
+	"time"
 
-	log "github.com/sirupsen/logrus"
-	"github.com/cowdude/flapi/src/audio"
 	"github.com/gorilla/websocket"
 )
 
+// Client is the websocket transport of a session.
 type Client struct {
-	GUID    string
+	*Session
 	Conn    *websocket.Conn
 	Request *http.Request
-	Audio   struct {
-		In       *audio.ChanReader
-		InfoC    chan audio.WAVEInfo
-		Activity chan audio.Activity
-	}
-}
-
-type ClientEvent string
 
-const (
-	EStatusChanged ClientEvent = "status_changed"
-	EPrediction                = "prediction"
-)
-
-type EventPayload struct {
-	Event   ClientEvent `json:"event"`
-	Result  interface{} `json:"result,omitempty"`
-	Message string      `json:"message,omitempty"`
+	writeDone chan struct{}
 }
 
-var clientIDCounter uint64
-
-func (c *Client) SendEvent(e EventPayload) {
-	err := c.Conn.WriteJSON(e)
-	if err != nil {
-		log.Warnf("failed to send event: %v", err)
-	}
+// closeCodes maps the reasons sessions end to websocket close codes.
+var closeCodes = map[EndReason]int{
+	EndNormal:       websocket.CloseNormalClosure,
+	EndIdle:         CloseIdleTimeout,
+	EndSlowConsumer: CloseSlowConsumer,
+	EndPolicy:       websocket.ClosePolicyViolation,
+	EndKicked:       websocket.ClosePolicyViolation,
+	EndShutdown:     websocket.CloseGoingAway,
+	EndUnsupported:  websocket.CloseUnsupportedData,
+	EndError:        websocket.CloseInternalServerErr,
 }
 
-func NewClient(conn *websocket.Conn, r *http.Request) (c *Client) {
-	counter := 1 + atomic.AddUint64(&clientIDCounter, 1)
-	log.WithField("GUID", counter).Println("Created new client")
-	c = &Client{
-		GUID:    fmt.Sprintf("%08X", counter),
-		Conn:    conn,
-		Request: r,
-	}
-
-	c.Audio.In = audio.NewChanReader()
-	transcoder := audio.Transcode(r.Context(), c.Audio.In, audio.WAV, 16000)
-	c.Audio.Activity = make(chan audio.Activity, 1)
-	c.Audio.InfoC = make(chan audio.WAVEInfo, 1)
-
-	go func() {
-		defer c.Audio.In.Close()
-		err := audio.ScanActivity(r.Context(), transcoder, c.Audio.InfoC, c.Audio.Activity, Config.Activity)
-		log.WithField("guid", c.GUID).WithError(err).Println("Exited scan goroutine")
-	}()
-	go func() {
-		defer close(c.Audio.Activity)
-		defer close(c.Audio.InfoC)
-		err := c.run()
-		log.WithField("guid", c.GUID).WithError(err).Println("Exited run goroutine")
-	}()
+// writeEvents is the only goroutine allowed to write to the websocket connection.
+// It also keeps the connection alive, and closes it once the session is over.
+func (c *Client) writeEvents() (err error) {
+	defer c.Conn.Close()
+	ping := time.NewTicker(c.cfg.HTTP.PingInterval)
+	defer ping.Stop()
 
-	select {
-	case <-asrReady:
-		c.SendEvent(EventPayload{
-			Event:   EStatusChanged,
-			Result:  true,
-			Message: "ASR ready",
-		})
-	default:
-		c.SendEvent(EventPayload{
-			Event:   EStatusChanged,
-			Result:  false,
-			Message: "ASR still warming up",
-		})
-	}
-	return
-}
-
-func (c *Client) handleBinary(data []byte) (err error) {
-	log.WithField("bytes", len(data)).Trace("Recv binary message")
-	select {
-	case <-asrReady:
-		if _, err := c.Audio.In.Write(data); err != nil { //shadowing intentional, dont care.
-			log.Warnf("Failed to buffer audio: %v", err) //shortWrite
+	for {
+		select {
+		case <-c.Done():
+			for _, e := range c.FlushEvents() {
+				if err = c.writeEvent(e); err != nil {
+					break
+				}
+			}
+			deadline := time.Now().Add(c.cfg.HTTP.WriteTimeout)
+			c.Conn.WriteControl(websocket.CloseMessage, c.closeMessage(), deadline)
+			return c.ctx.Err()
+		case e := <-c.Events():
+			if err = c.writeEvent(e); err != nil {
+				c.cancel()
+				return
+			}
+		case <-ping.C:
+			deadline := time.Now().Add(c.cfg.HTTP.WriteTimeout)
+			if err = c.Conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.cancel()
+				return
+			}
 		}
-		return
-	default:
-		c.SendEvent(EventPayload{
-			Event:   "error",
-			Result:  false,
-			Message: "ASR still warming up",
-		})
-		return
 	}
 }
 
-func (c *Client) predict(counter *uint, format audio.WAVEInfo, data []byte) (pred Prediction, err error) {
-	f, err := os.Create(path.Join(os.TempDir(), fmt.Sprintf("%v_%04x.wav", c.GUID, *counter)))
-	*counter++
-	if err != nil {
-		log.Panic(err)
-	}
-	defer os.Remove(f.Name())
-
-	format.FileSize = audio.WAVHeaderSize + uint32(len(data))
-	if err = audio.WriteWAVHeader(f, format); err != nil {
-		f.Close()
-		return
+func (c *Client) writeEvent(e EventPayload) error {
+	if e.Event == ESpeech {
+		return nil //not part of the v1 protocol
 	}
-	if _, err = io.Copy(f, bytes.NewReader(data)); err != nil {
-		f.Close()
-		return
-	}
-	if err = f.Close(); err != nil {
-		return
-	}
-
-	log.Debugf("wrote tmp WAV file: %v", f.Name())
-	return asr.Predict(f.Name())
+	c.Conn.SetWriteDeadline(time.Now().Add(c.cfg.HTTP.WriteTimeout))
+	return c.Conn.WriteJSON(e)
 }
 
-func (c *Client) run() (err error) {
-	defer log.WithField("guid", c.GUID).Print("client runner exited")
-	ctx := c.Request.Context()
+func (c *Client) closeMessage() []byte {
+	reason, message := c.EndReason()
+	return websocket.FormatCloseMessage(closeCodes[reason], message)
+}
 
-	var counter uint
-	var format audio.WAVEInfo
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case format = <-c.Audio.InfoC:
+// NewClient starts a session for a websocket connection, and its writer goroutine.
+func NewClient(conn *websocket.Conn, r *http.Request, keyLabel string) (c *Client) {
+	c = &Client{
+		Session: NewSession(r.Context(), SessionOptions{
+			Transport: "websocket",
+			Remote:    r.RemoteAddr,
+			KeyLabel:  keyLabel,
+		}),
+		Conn:      conn,
+		Request:   r,
+		writeDone: make(chan struct{}),
 	}
+	go func() {
+		defer close(c.writeDone)
+		err := c.writeEvents()
+		c.log.WithError(err).Println("Exited writer goroutine")
+	}()
+	return
+}
 
-	log.Debugf("ASR input audio format: %+v", format)
-	for {
-		var prediction Prediction
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case event := <-c.Audio.Activity:
-			log.Debugf("audio activity: start=%v duration=%v gain=~%v", event.Start, event.Duration, event.Mean)
-			if prediction, err = c.predict(&counter, format, event.Frames); err != nil {
-				return
-			}
-			log.Debugf("got prediction: %v", prediction)
-			c.SendEvent(EventPayload{
-				Event:  EPrediction,
-				Result: prediction,
-			})
-		}
-	}
+// Close ends the session, and waits for its pipeline and writer goroutine.
+func (c *Client) Close() error {
+	c.Session.Close()
+	<-c.writeDone
+	return nil
 }
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cowdude/flapi/src/audio"
+	"github.com/cowdude/flapi/src/recognizer"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// ProtocolV2 is the name of the /v2/ws protocol, sent in the hello event.
+const ProtocolV2 = "flapi.v2"
+
+// Types of the messages sent by /v2/ws clients.
+const (
+	CConfig = "config" //session settings, before start
+	CStart  = "start"  //starts the session: audio is accepted from now on
+	CStop   = "stop"   //ends the session now, dropping the pending segments
+	CEOS    = "eos"    //end of stream: ends the session once the audio received is transcribed
+	CPing   = "ping"
+)
+
+// Types of the events sent to /v2/ws clients.
+const (
+	V2Hello      = "hello"
+	V2Configured = "configured"
+	V2Started    = "started"
+	V2Status     = "status"
+	V2Speech     = "speech"
+	V2Prediction = "prediction"
+	V2Revision   = "revision"
+	V2Overrun    = "overrun"
+	V2Error      = "error"
+	V2Pong       = "pong"
+	V2End        = "end"
+)
+
+// ClientMessage is a text message sent by a /v2/ws client. Fields other than
+// type and id only apply to some message types.
+type ClientMessage struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"` //echoed in the pong or error answering the message
+
+	Overflow audio.OverflowPolicy `json:"overflow,omitempty"` //config: overrides input.overflow
+	Speech   *bool                `json:"speech,omitempty"`   //config: send speech events, true by default
+}
+
+// V2Header is common to all the events sent to /v2/ws clients. Sequence numbers
+// start at 1 and increase by 1 with each event of the connection.
+type V2Header struct {
+	Seq  uint64 `json:"seq"`
+	Type string `json:"type"`
+	Key  string `json:"key,omitempty"`
+}
+
+func (h *V2Header) header() *V2Header { return h }
+
+// V2Event is an event sent to /v2/ws clients.
+type V2Event interface {
+	header() *V2Header
+}
+
+type HelloEvent struct {
+	V2Header
+	Protocol string `json:"protocol"`
+	Ready    bool   `json:"ready"`
+}
+
+type ConfiguredEvent struct {
+	V2Header
+	Overflow audio.OverflowPolicy `json:"overflow"`
+	Speech   bool                 `json:"speech"`
+}
+
+type StartedEvent struct {
+	V2Header
+	Session string `json:"session"`
+}
+
+type StatusEvent struct {
+	V2Header
+	Ready   bool   `json:"ready"`
+	Message string `json:"message"`
+}
+
+type SpeechEvent struct {
+	V2Header
+	Speech
+}
+
+type PredictionEvent struct {
+	V2Header
+	Segment uint   `json:"segment"`
+	Text    string `json:"text"`
+}
+
+type RevisionEvent struct {
+	V2Header
+	Revision
+}
+
+type OverrunEvent struct {
+	V2Header
+	Overrun
+}
+
+type ErrorEvent struct {
+	V2Header
+	ID      string `json:"id,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type PongEvent struct {
+	V2Header
+	ID string `json:"id,omitempty"`
+}
+
+// EndEvent is the last event of a connection, sent before the close frame.
+type EndEvent struct {
+	V2Header
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// ClientV2 is a /v2/ws connection. Unlike v1 clients, its session only starts
+// with the start message, so that the client can configure it beforehand.
+type ClientV2 struct {
+	Conn     *websocket.Conn
+	Request  *http.Request
+	KeyLabel string
+
+	cfg *Configuration
+	log *log.Entry
+
+	//owned by the reader
+	session    *Session
+	eos        bool
+	overflow   audio.OverflowPolicy
+	speech     bool
+	helloReady bool //the hello event told the client that the ASR was ready
+
+	//owned by the writer
+	seq uint64
+
+	out       chan v2Out
+	quit      chan struct{}
+	writeDone chan struct{}
+}
+
+// v2Out is an item of the writer queue: an event, or the session to attach.
+type v2Out struct {
+	event   V2Event
+	session *Session
+	speech  bool
+}
+
+// toV2Event converts a session event, or returns nil when the client doesn't want it.
+func toV2Event(e EventPayload, speech bool) V2Event {
+	switch e.Event {
+	case EStatusChanged:
+		ready, _ := e.Result.(bool)
+		return &StatusEvent{V2Header: V2Header{Type: V2Status}, Ready: ready, Message: e.Message}
+	case ESpeech:
+		if !speech {
+			return nil
+		}
+		return &SpeechEvent{V2Header: V2Header{Type: V2Speech}, Speech: e.Result.(Speech)}
+	case EPrediction:
+		pred := e.Result.(recognizer.Prediction)
+		return &PredictionEvent{V2Header: V2Header{Type: V2Prediction}, Segment: pred.Segment, Text: pred.Text}
+	case ERevision:
+		return &RevisionEvent{V2Header: V2Header{Type: V2Revision}, Revision: e.Result.(Revision)}
+	case EOverrun:
+		return &OverrunEvent{V2Header: V2Header{Type: V2Overrun}, Overrun: e.Result.(Overrun)}
+	case EError:
+		return &ErrorEvent{V2Header: V2Header{Type: V2Error}, Code: e.Code, Message: e.Message}
+	}
+	return nil
+}
+
+func errorEvent(id, code, message string) *ErrorEvent {
+	return &ErrorEvent{V2Header: V2Header{Type: V2Error}, ID: id, Code: code, Message: message}
+}
+
+func (c *ClientV2) writeEvent(e V2Event) error {
+	c.seq++
+	h := e.header()
+	h.Seq, h.Key = c.seq, c.KeyLabel
+	c.Conn.SetWriteDeadline(time.Now().Add(c.cfg.HTTP.WriteTimeout))
+	return c.Conn.WriteJSON(e)
+}
+
+// end sends the end event and the close frame.
+func (c *ClientV2) end(reason EndReason, message string) {
+	c.writeEvent(&EndEvent{V2Header: V2Header{Type: V2End}, Reason: reason.String(), Message: message})
+	deadline := time.Now().Add(c.cfg.HTTP.WriteTimeout)
+	c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCodes[reason], message), deadline)
+}
+
+// writeEvents is the only goroutine allowed to write to the websocket connection.
+// Before the session starts, it also enforces http.idle_timeout and the shutdown.
+func (c *ClientV2) writeEvents() (err error) {
+	defer c.Conn.Close()
+	ping := time.NewTicker(c.cfg.HTTP.PingInterval)
+	defer ping.Stop()
+	var idle <-chan time.Time
+	if c.cfg.HTTP.IdleTimeout > 0 {
+		timer := time.NewTimer(c.cfg.HTTP.IdleTimeout)
+		defer timer.Stop()
+		idle = timer.C
+	}
+	drain := drainingC
+
+	var (
+		s      *Session
+		events <-chan EventPayload
+		done   <-chan struct{}
+		speech bool
+	)
+	for {
+		select {
+		case o := <-c.out:
+			if o.session != nil {
+				s, events, done, speech = o.session, o.session.Events(), o.session.Done(), o.speech
+				idle, drain = nil, nil //the session enforces its own limits
+				o.event = &StartedEvent{V2Header: V2Header{Type: V2Started}, Session: s.GUID}
+			}
+			if err = c.writeEvent(o.event); err != nil {
+				return
+			}
+		case e := <-events:
+			if ve := toV2Event(e, speech); ve != nil {
+				if err = c.writeEvent(ve); err != nil {
+					return
+				}
+			}
+		case <-done:
+			for _, e := range s.FlushEvents() {
+				if ve := toV2Event(e, speech); ve != nil {
+					if err = c.writeEvent(ve); err != nil {
+						return
+					}
+				}
+			}
+			c.end(s.EndReason())
+			return
+		case <-idle:
+			c.end(EndIdle, fmt.Sprintf("no start message received for %v", c.cfg.HTTP.IdleTimeout))
+			return
+		case <-drain:
+			c.end(EndShutdown, "server shutting down")
+			return
+		case <-c.quit:
+			//the client left, or stopped before starting
+			c.end(EndNormal, "")
+			return
+		case <-ping.C:
+			deadline := time.Now().Add(c.cfg.HTTP.WriteTimeout)
+			if err = c.Conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// send queues an event for the writer. It returns false when the client
+// doesn't read its events fast enough.
+func (c *ClientV2) send(o v2Out) bool {
+	select {
+	case c.out <- o:
+		return true
+	case <-c.writeDone:
+		return false
+	default:
+		c.log.Warn("event queue full, closing the connection")
+		if c.session != nil {
+			c.session.End(EndSlowConsumer, "event queue full")
+		}
+		return false
+	}
+}
+
+// handleMessage handles a text message. It returns false when the connection must be closed.
+func (c *ClientV2) handleMessage(data []byte) bool {
+	var msg ClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return c.send(v2Out{event: errorEvent("", ErrCodeInvalidMessage, fmt.Sprintf("invalid message: %v", err))})
+	}
+	c.log.WithField("type", msg.Type).Debug("Recv message")
+	switch msg.Type {
+	case CConfig:
+		if c.session != nil {
+			return c.send(v2Out{event: errorEvent(msg.ID, ErrCodeInvalidState, "config is only allowed before start")})
+		}
+		switch msg.Overflow {
+		case "", audio.Block, audio.DropOldest, audio.Reject:
+		default:
+			return c.send(v2Out{event: errorEvent(msg.ID, ErrCodeInvalidMessage, fmt.Sprintf("unknown overflow policy '%v'", msg.Overflow))})
+		}
+		if msg.Overflow != "" {
+			c.overflow = msg.Overflow
+		}
+		if msg.Speech != nil {
+			c.speech = *msg.Speech
+		}
+		return c.send(v2Out{event: &ConfiguredEvent{V2Header: V2Header{Type: V2Configured}, Overflow: c.overflow, Speech: c.speech}})
+	case CStart:
+		if c.session != nil {
+			return c.send(v2Out{event: errorEvent(msg.ID, ErrCodeInvalidState, "session already started")})
+		}
+		if isDraining() {
+			return c.send(v2Out{event: errorEvent(msg.ID, ErrCodeShuttingDown, "server shutting down")})
+		}
+		c.session = NewSession(c.Request.Context(), SessionOptions{
+			Transport: "websocket/v2",
+			Remote:    c.Request.RemoteAddr,
+			KeyLabel:  c.KeyLabel,
+			Overflow:  c.overflow,
+		})
+		registerSession(c.session)
+		if !c.send(v2Out{session: c.session, speech: c.speech}) {
+			return false
+		}
+		//the ASR got ready after the hello: the status event dispatched by the
+		//warmup may have been sent before the session was registered
+		select {
+		case <-asrReady:
+			if !c.helloReady {
+				return c.send(v2Out{event: &StatusEvent{V2Header: V2Header{Type: V2Status}, Ready: true, Message: "ASR is ready"}})
+			}
+		default:
+		}
+		return true
+	case CStop:
+		if c.session == nil {
+			return false
+		}
+		c.session.End(EndNormal, "stopped by the client")
+		return true
+	case CEOS:
+		if c.session == nil {
+			return c.send(v2Out{event: errorEvent(msg.ID, ErrCodeInvalidState, "session not started")})
+		}
+		c.eos = true
+		c.session.CloseInput()
+		return true
+	case CPing:
+		return c.send(v2Out{event: &PongEvent{V2Header: V2Header{Type: V2Pong}, ID: msg.ID}})
+	}
+	return c.send(v2Out{event: errorEvent(msg.ID, ErrCodeInvalidMessage, fmt.Sprintf("unknown message type '%v'", msg.Type))})
+}
+
+// handleAudio handles a binary message.
+func (c *ClientV2) handleAudio(data []byte) bool {
+	switch {
+	case c.session == nil:
+		return c.send(v2Out{event: errorEvent("", ErrCodeInvalidState, "audio received before start, dropped")})
+	case c.eos:
+		return c.send(v2Out{event: errorEvent("", ErrCodeInvalidState, "audio received after eos, dropped")})
+	}
+	if err := c.session.Write(data); err != nil {
+		c.log.Warnf("handle binary: %v", err)
+		c.session.End(EndError, err.Error())
+	}
+	return true
+}
+
+// NewClientV2 returns a /v2/ws client, and starts its writer goroutine with the hello event.
+func NewClientV2(conn *websocket.Conn, r *http.Request, keyLabel string) (c *ClientV2) {
+	cfg := Config()
+	c = &ClientV2{
+		Conn:      conn,
+		Request:   r,
+		KeyLabel:  keyLabel,
+		cfg:       cfg,
+		log:       log.WithField("remote", r.RemoteAddr),
+		overflow:  cfg.Input.Overflow,
+		speech:    true,
+		out:       make(chan v2Out, cfg.HTTP.SendQueue),
+		quit:      make(chan struct{}),
+		writeDone: make(chan struct{}),
+	}
+	if keyLabel != "" {
+		c.log = c.log.WithField("key", keyLabel)
+	}
+	select {
+	case <-asrReady:
+		c.helloReady = true
+	default:
+	}
+	c.out <- v2Out{event: &HelloEvent{V2Header: V2Header{Type: V2Hello}, Protocol: ProtocolV2, Ready: c.helloReady}}
+	go func() {
+		defer close(c.writeDone)
+		err := c.writeEvents()
+		c.log.WithError(err).Debug("Exited v2 writer goroutine")
+	}()
+	return
+}
+
+// Close ends the session if it started, and waits for the writer goroutine.
+func (c *ClientV2) Close() error {
+	if c.session != nil {
+		c.session.Close()
+		unregisterSession(c.session)
+	}
+	close(c.quit)
+	<-c.writeDone
+	return nil
+}
+
+func handleWSv2(w http.ResponseWriter, r *http.Request) {
+	c, label, ok := acceptWS(w, r)
+	if !ok {
+		return
+	}
+	defer c.Close()
+
+	if err := acquireSession(label); err != nil {
+		log.WithField("key", label).Warnf("session rejected: %v", err)
+		client := &ClientV2{Conn: c, KeyLabel: label, cfg: Config()}
+		client.writeEvent(errorEvent("", err.(*QuotaError).Code, err.Error()))
+		client.end(EndPolicy, err.Error())
+		return
+	}
+	defer releaseSession(label)
+
+	client := NewClientV2(c, r, label)
+	defer client.Close()
+
+	//pongs and messages extend the read deadline; a silent peer is dropped
+	//after missing a pong for http.pong_timeout.
+	extendDeadline := func() {
+		c.SetReadDeadline(time.Now().Add(client.cfg.HTTP.PingInterval + client.cfg.HTTP.PongTimeout))
+	}
+	extendDeadline()
+	c.SetReadLimit(client.cfg.HTTP.MaxMessageSize)
+	c.SetPongHandler(func(string) error {
+		extendDeadline()
+		return nil
+	})
+
+	for {
+		mt, data, err := c.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				client.log.Warnf("read: %v", err)
+			}
+			return
+		}
+		extendDeadline()
+		switch mt {
+		case websocket.BinaryMessage:
+			ok = client.handleAudio(data)
+		case websocket.TextMessage:
+			ok = client.handleMessage(data)
+		}
+		if !ok {
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cowdude/flapi/src/client"
+	"github.com/gorilla/websocket"
+)
+
+// dialTest starts a /v2/ws test server, and connects a client to it.
+func dialTest(t *testing.T, opts client.Options) *client.Client {
+	server := httptest.NewServer(http.HandlerFunc(handleWSv2))
+	t.Cleanup(server.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := client.Dial(ctx, server.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if err = c.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestWSv2Stream(t *testing.T) {
+	var transcript client.Transcript
+	var predictions int
+	c := dialTest(t, client.Options{OnEvent: func(e client.Event) {
+		if _, ok := e.(*client.Prediction); ok {
+			predictions++
+		}
+		transcript.Apply(e)
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	//no trailing silence: eos transcribes the last utterance
+	audio := testAudio(time.Second, 2*time.Second, time.Second)
+	if err := c.Stream(ctx, bytes.NewReader(audio)); err != nil {
+		t.Fatal(err)
+	}
+	if predictions != 2 || len(transcript.Segments) == 0 {
+		t.Fatalf("got %d predictions, transcript %+v", predictions, transcript.Segments)
+	}
+	if text := strings.TrimSpace(transcript.Text()); !strings.HasPrefix(text, testPrediction) {
+		t.Errorf("transcript %q", text)
+	}
+	first := transcript.Segments[0]
+	if first.Start > 0.1 || first.End < 0.9 || first.End > 2 {
+		t.Errorf("first segment spans %v-%vs, want about 0-1s", first.Start, first.End)
+	}
+}
+
+func TestWSv2Stop(t *testing.T) {
+	c := dialTest(t, client.Options{})
+	if _, err := c.Write(testAudio(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Wait(ctx); err != nil {
+		t.Errorf("stopped session: %v", err)
+	}
+}
+
+// A client connecting during the warmup, whose start arrives after the ASR got
+// ready, must be told so: it missed the status event of the warmup.
+func TestWSv2ReadyAfterHello(t *testing.T) {
+	prev := asrReady
+	asrReady = make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(handleWSv2))
+	defer func() {
+		server.Close()
+		asrReady = prev
+	}()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var hello HelloEvent
+	if err = ws.ReadJSON(&hello); err != nil || hello.Type != V2Hello || hello.Ready {
+		t.Fatalf("expected a hello not ready, got %+v, %v", hello, err)
+	}
+	close(asrReady) //the status event was dispatched to the registered sessions only
+	if err = ws.WriteJSON(map[string]string{"type": "start"}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		var status StatusEvent
+		if err = ws.ReadJSON(&status); err != nil {
+			t.Fatalf("no ready status: %v", err)
+		}
+		if status.Type == V2Status && status.Ready {
+			return
+		}
+	}
+}